@@ -0,0 +1,143 @@
+package composer
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry/libcfbuildpack/helper"
+	"github.com/cloudfoundry/libcfbuildpack/services"
+)
+
+const (
+	// CACertificatesBindingType is the type of service binding that supplies additional CA certificates
+	CACertificatesBindingType = "ca-certificates"
+	CACertificatesBundle      = "ca-certificates.pem"
+)
+
+// systemCABundles are the well-known locations of the system CA bundle, used when SSL_CERT_FILE is not set
+var systemCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/cert.pem",
+}
+
+// CACertificates are the CA certificates trusted by Composer, PHP and the GitHub client
+type CACertificates struct {
+	File   string
+	Dir    string
+	bundle []byte
+}
+
+// NewCACertificates honors SSL_CERT_FILE and SSL_CERT_DIR. When `ca-certificates` bindings are present, their
+// certificates are combined with the system bundle and File points at bundlePath, see WriteBundle.
+func NewCACertificates(bindings services.Services, bundlePath string) (CACertificates, error) {
+	certs := CACertificates{
+		File: os.Getenv("SSL_CERT_FILE"),
+		Dir:  os.Getenv("SSL_CERT_DIR"),
+	}
+
+	additional := bindingCertificates(bindings)
+	if len(additional) == 0 {
+		return certs, nil
+	}
+
+	base := certs.File
+	if base == "" {
+		for _, path := range systemCABundles {
+			if exists, err := helper.FileExists(path); err != nil {
+				return CACertificates{}, err
+			} else if exists {
+				base = path
+				break
+			}
+		}
+	}
+
+	bundle := bytes.Buffer{}
+	if base != "" {
+		buf, err := ioutil.ReadFile(base)
+		if err != nil {
+			return CACertificates{}, fmt.Errorf("unable to read CA bundle %s: %s", base, err)
+		}
+		bundle.Write(buf)
+		bundle.WriteString("\n")
+	}
+
+	for _, cert := range additional {
+		bundle.WriteString(strings.TrimSpace(cert))
+		bundle.WriteString("\n")
+	}
+
+	certs.File = bundlePath
+	certs.bundle = bundle.Bytes()
+	return certs, nil
+}
+
+// WriteBundle writes the combined CA bundle, if bindings supplied additional certificates
+func (c CACertificates) WriteBundle() error {
+	if len(c.bundle) == 0 {
+		return nil
+	}
+
+	return helper.WriteFile(c.File, 0644, string(c.bundle))
+}
+
+// Export sets SSL_CERT_FILE and SSL_CERT_DIR so later steps of this build trust the same certificates
+func (c CACertificates) Export() error {
+	if c.File != "" {
+		if err := os.Setenv("SSL_CERT_FILE", c.File); err != nil {
+			return err
+		}
+	}
+
+	if c.Dir != "" {
+		if err := os.Setenv("SSL_CERT_DIR", c.Dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IniDirectives returns the php.ini settings that make PHP's openssl extension trust these certificates
+func (c CACertificates) IniDirectives() map[string]string {
+	directives := map[string]string{}
+
+	if c.File != "" {
+		directives["openssl.cafile"] = fmt.Sprintf(`"%s"`, c.File)
+	}
+
+	if c.Dir != "" {
+		directives["openssl.capath"] = fmt.Sprintf(`"%s"`, c.Dir)
+	}
+
+	return directives
+}
+
+func bindingCertificates(bindings services.Services) []string {
+	certs := []string{}
+
+	for _, binding := range bindings.Services {
+		if !IsBindingType(binding, CACertificatesBindingType) {
+			continue
+		}
+
+		keys := []string{}
+		for key := range binding.Credentials {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if cert, ok := binding.Credentials[key].(string); ok && strings.Contains(cert, "-----BEGIN CERTIFICATE-----") {
+				certs = append(certs, cert)
+			}
+		}
+	}
+
+	return certs
+}
@@ -0,0 +1,101 @@
+package composer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/libcfbuildpack/services"
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+const (
+	systemCert  = "-----BEGIN CERTIFICATE-----\nsystem\n-----END CERTIFICATE-----"
+	bindingCert = "-----BEGIN CERTIFICATE-----\nbinding\n-----END CERTIFICATE-----"
+)
+
+func TestUnitCACertificates(t *testing.T) {
+	spec.Run(t, "CACertificates", testCACertificates, spec.Report(report.Terminal{}))
+}
+
+func testCACertificates(t *testing.T, when spec.G, it spec.S) {
+	var (
+		factory    *test.BuildFactory
+		bundlePath string
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		factory = test.NewBuildFactory(t)
+		bundlePath = filepath.Join(factory.Build.Application.Root, "bundle", composer.CACertificatesBundle)
+	})
+
+	it.After(func() {
+		Expect(os.Unsetenv("SSL_CERT_FILE")).To(Succeed())
+		Expect(os.Unsetenv("SSL_CERT_DIR")).To(Succeed())
+	})
+
+	when("there are no ca-certificates bindings", func() {
+		it("uses SSL_CERT_FILE and SSL_CERT_DIR", func() {
+			Expect(os.Setenv("SSL_CERT_FILE", "/certs/bundle.pem")).To(Succeed())
+			Expect(os.Setenv("SSL_CERT_DIR", "/certs")).To(Succeed())
+
+			certs, err := composer.NewCACertificates(factory.Build.Services, bundlePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(certs.File).To(Equal("/certs/bundle.pem"))
+			Expect(certs.Dir).To(Equal("/certs"))
+			Expect(certs.IniDirectives()).To(Equal(map[string]string{
+				"openssl.cafile": `"/certs/bundle.pem"`,
+				"openssl.capath": `"/certs"`,
+			}))
+
+			Expect(certs.WriteBundle()).To(Succeed())
+			Expect(bundlePath).NotTo(BeAnExistingFile())
+		})
+
+		it("configures nothing without SSL_CERT_FILE and SSL_CERT_DIR", func() {
+			certs, err := composer.NewCACertificates(factory.Build.Services, bundlePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(certs.IniDirectives()).To(BeEmpty())
+		})
+	})
+
+	when("there is a ca-certificates binding", func() {
+		it("combines SSL_CERT_FILE with the bound certificates", func() {
+			systemBundle := filepath.Join(factory.Build.Application.Root, "system.pem")
+			test.WriteFile(t, systemBundle, systemCert)
+			Expect(os.Setenv("SSL_CERT_FILE", systemBundle)).To(Succeed())
+
+			factory.AddService("ca-certificates", services.Credentials{
+				"proxy.pem": bindingCert,
+				"README":    "not a certificate",
+			})
+
+			certs, err := composer.NewCACertificates(factory.Build.Services, bundlePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(certs.File).To(Equal(bundlePath))
+
+			Expect(certs.WriteBundle()).To(Succeed())
+			contents, err := ioutil.ReadFile(bundlePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal(systemCert + "\n" + bindingCert + "\n"))
+
+			Expect(certs.Export()).To(Succeed())
+			Expect(os.Getenv("SSL_CERT_FILE")).To(Equal(bundlePath))
+		})
+
+		it("returns an error when SSL_CERT_FILE cannot be read", func() {
+			Expect(os.Setenv("SSL_CERT_FILE", "/does/not/exist.pem")).To(Succeed())
+			factory.AddService("proxy", services.Credentials{"proxy.pem": bindingCert}, "ca-certificates")
+
+			_, err := composer.NewCACertificates(factory.Build.Services, bundlePath)
+			Expect(err).To(MatchError(ContainSubstring("unable to read CA bundle /does/not/exist.pem")))
+		})
+	})
+}
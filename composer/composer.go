@@ -1,15 +1,20 @@
 package composer
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
+	"github.com/Masterminds/semver"
 	"github.com/cloudfoundry/libcfbuildpack/helper"
 	"github.com/cloudfoundry/libcfbuildpack/logger"
+	"github.com/cloudfoundry/libcfbuildpack/services"
 	"github.com/paketo-buildpacks/php-composer/runner"
 	"github.com/paketo-buildpacks/php-web/config"
 	"gopkg.in/yaml.v2"
@@ -19,41 +24,129 @@ const (
 	Dependency         = "composer"
 	PackagesDependency = "php-composer-packages"
 	CacheDependency    = "php-composer-cache"
+	SBOMDependency     = "php-composer-sbom"
+	AdvisoryDependency = "security-advisories"
+	DevToolsDependency = "php-composer-dev-tools"
 	ComposerLock       = "composer.lock"
 	ComposerJSON       = "composer.json"
 	ComposerPHAR       = "composer.phar"
 	GithubOAUTHKey     = "github-oauth.github.com"
 )
 
+const (
+	// VendorModeSymlink links the vendor directory of the app to the packages layer
+	VendorModeSymlink = "symlink"
+
+	// VendorModeCopy copies the cached packages layer to the vendor directory of the app
+	VendorModeCopy = "copy"
+)
+
+// memoryExhaustedMessage is the start of PHP's fatal error when memory_limit is reached
+const memoryExhaustedMessage = "Allowed memory size of"
+
+// MemoryExhaustedError is returned when Composer fails because it reached PHP's memory_limit
+type MemoryExhaustedError struct {
+	Err error
+}
+
+func (e MemoryExhaustedError) Error() string {
+	return fmt.Sprintf("composer ran out of memory: %s", e.Err)
+}
+
+func (e MemoryExhaustedError) Unwrap() error {
+	return e.Err
+}
+
 // Composer runner
 type Composer struct {
 	Logger     logger.Logger
 	Runner     runner.Runner
 	workingDir string
 	pharPath   string
+	output     *bytes.Buffer
+	version    *versionCache
+}
+
+// versionCache is shared by copies of a Composer, so `composer -V` only runs once
+type versionCache struct {
+	version *semver.Version
 }
 
 // NewComposer creates a new Composer runner
 func NewComposer(composerJsonPath, composerPharPath string, logger logger.Logger) Composer {
+	output := &bytes.Buffer{}
+
 	return Composer{
 		Logger: logger,
 		Runner: runner.ComposerRunner{
 			Logger: logger,
+			Out:    output,
+			Err:    output,
 		},
 		workingDir: composerJsonPath,
 		pharPath:   filepath.Join(composerPharPath, ComposerPHAR),
+		output:     output,
+		version:    &versionCache{},
 	}
 }
 
-// Install runs `composer install`
+// Install runs `composer install`, returning a MemoryExhaustedError when PHP runs out of memory
 func (c Composer) Install(args ...string) error {
 	args = append([]string{c.pharPath, "install", "--no-progress"}, args...)
-	return c.Runner.Run("php", c.workingDir, args...)
+
+	if c.output != nil {
+		c.output.Reset()
+	}
+
+	err := c.Runner.Run("php", c.workingDir, args...)
+	if err != nil && c.output != nil && strings.Contains(c.output.String(), memoryExhaustedMessage) {
+		return MemoryExhaustedError{Err: err}
+	}
+
+	return err
+}
+
+// Version runs `composer -V` and returns the parsed version
+func (c Composer) Version() (*semver.Version, error) {
+	if c.version != nil && c.version.version != nil {
+		return c.version.version, nil
+	}
+
+	output, err := c.Runner.RunWithOutput("php", c.workingDir, c.pharPath, "-V")
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := ParseVersion(output)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.version != nil {
+		c.version.version = version
+	}
+
+	return version, nil
 }
 
-// Version runs `composer version`
-func (c Composer) Version() error {
-	return c.Runner.Run("php", c.workingDir, c.pharPath, "-V")
+// AtLeast reports whether Composer's version satisfies the given minimum
+func (c Composer) AtLeast(minimum string) (bool, error) {
+	version, err := c.Version()
+	if err != nil {
+		return false, err
+	}
+
+	return !version.LessThan(semver.MustParse(minimum)), nil
+}
+
+// SupportsAllowPlugins reports whether Composer requires plugins to be listed in `config.allow-plugins`
+func (c Composer) SupportsAllowPlugins() (bool, error) {
+	return c.AtLeast("2.2.0")
+}
+
+// SupportsAudit reports whether Composer supports `composer audit` and audits packages after install
+func (c Composer) SupportsAudit() (bool, error) {
+	return c.AtLeast("2.4.0")
 }
 
 // Global runs `composer global`
@@ -62,6 +155,18 @@ func (c Composer) Global(args ...string) error {
 	return c.Runner.Run("php", c.workingDir, args...)
 }
 
+// DumpAutoload runs `composer dump-autoload`
+func (c Composer) DumpAutoload(args ...string) error {
+	args = append([]string{c.pharPath, "dump-autoload"}, args...)
+	return c.Runner.Run("php", c.workingDir, args...)
+}
+
+// RunScript runs `composer run-script`
+func (c Composer) RunScript(script string, args ...string) error {
+	args = append([]string{c.pharPath, "run-script", script}, args...)
+	return c.Runner.Run("php", c.workingDir, args...)
+}
+
 // Config runs `composer config`
 func (c Composer) Config(key, value string, global bool) error {
 	args := []string{c.pharPath, "config"}
@@ -98,6 +203,19 @@ func (c Composer) CheckPlatformReqs() ([]string, error) {
 	return extensions, nil
 }
 
+// versionPattern matches the output of `composer -V`, e.g. "Composer version 2.1.3 2021-06-09 16:31:20"
+var versionPattern = regexp.MustCompile(`Composer (?:version )?v?(\d+\.\d+\.\d+\S*)`)
+
+// ParseVersion extracts the Composer version from the output of `composer -V`
+func ParseVersion(output string) (*semver.Version, error) {
+	matches := versionPattern.FindStringSubmatch(output)
+	if matches == nil {
+		return nil, fmt.Errorf("unable to find a Composer version in %q", strings.TrimSpace(output))
+	}
+
+	return semver.NewVersion(matches[1])
+}
+
 // FindComposer locates the composer JSON and composer lock files
 func FindComposer(appRoot string, composerJSONPath string) (string, error) {
 	phpBuildpackYAML, err := config.LoadBuildpackYAML(appRoot)
@@ -129,12 +247,102 @@ func FindComposer(appRoot string, composerJSONPath string) (string, error) {
 	return "", fmt.Errorf(`no "%s" found in the following locations: %v`, ComposerJSON, paths)
 }
 
+// IsBindingType reports whether a binding is of the given type, by binding name, label or tag
+func IsBindingType(binding services.Service, bindingType string) bool {
+	if binding.BindingName == bindingType || binding.Label == bindingType {
+		return true
+	}
+
+	for _, tag := range binding.Tags {
+		if tag == bindingType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Repository is an additional Composer repository, see https://getcomposer.org/doc/05-repositories.md
+type Repository struct {
+	Name string `yaml:"name" json:"-"`
+	Type string `yaml:"type" json:"type"`
+	URL  string `yaml:"url" json:"url"`
+}
+
+// PhpIni configures the php.ini used only while Composer runs, not the app's launch-time .php.ini.d
+type PhpIni struct {
+	Extensions []string          `yaml:"extensions"`
+	Directives map[string]string `yaml:"directives"`
+}
+
+// Hook is a command run in the app directory after packages are installed
+type Hook struct {
+	Command         string `yaml:"command"`
+	Timeout         string `yaml:"timeout"`
+	ContinueOnError bool   `yaml:"continue_on_error"`
+}
+
+// Autoloader configures how Composer optimizes the generated autoloader, see https://getcomposer.org/doc/articles/autoloader-optimization.md
+type Autoloader struct {
+	Optimize      bool `yaml:"optimize"`
+	Authoritative bool `yaml:"authoritative"`
+	APCu          bool `yaml:"apcu"`
+}
+
+// Preload configures the generation of an OPcache preload script from the classmap
+type Preload struct {
+	Enabled    bool     `yaml:"enabled"`
+	Namespaces []string `yaml:"namespaces"`
+	User       string   `yaml:"user"`
+}
+
+// LicensePolicy lists the SPDX license identifiers that packages may or must not be licensed under
+type LicensePolicy struct {
+	Allowed []string `yaml:"allowed"`
+	Denied  []string `yaml:"denied"`
+}
+
+// Audit configures the offline audit of composer.lock against a security advisory database
+type Audit struct {
+	Enabled         bool   `yaml:"enabled"`
+	Database        string `yaml:"database"`
+	FailOn          string `yaml:"fail_on"`
+	UnknownSeverity string `yaml:"unknown_severity"`
+}
+
+// Prune configures the removal of files that are not needed at runtime from installed packages
+type Prune struct {
+	Enabled  bool     `yaml:"enabled"`
+	Patterns []string `yaml:"patterns"`
+}
+
 type ComposerConfig struct {
-	Version         string   `yaml:"version"`
-	InstallOptions  []string `yaml:"install_options"`
-	VendorDirectory string   `yaml:"vendor_directory"`
-	JsonPath        string   `yaml:"json_path"`
-	InstallGlobal   []string `yaml:"install_global"`
+	Version          string        `yaml:"version"`
+	InstallOptions   []string      `yaml:"install_options"`
+	VendorDirectory  string        `yaml:"vendor_directory"`
+	JsonPath         string        `yaml:"json_path"`
+	InstallGlobal    []string      `yaml:"install_global"`
+	PackagistMirror  string        `yaml:"packagist_mirror"`
+	DisablePackagist bool          `yaml:"disable_packagist"`
+	Repositories     []Repository  `yaml:"repositories"`
+	PhpIni           PhpIni        `yaml:"php_ini"`
+	RetryOnOOM       bool          `yaml:"retry_on_oom"`
+	RetryMemoryLimit string        `yaml:"retry_memory_limit"`
+	AllowPlugins     []string      `yaml:"allow_plugins"`
+	DenyPlugins      []string      `yaml:"deny_plugins"`
+	NoScripts        bool          `yaml:"no_scripts"`
+	AllowedScripts   []string      `yaml:"allowed_scripts"`
+	PostInstall      []Hook        `yaml:"post_install"`
+	Autoloader       Autoloader    `yaml:"autoloader"`
+	Preload          Preload       `yaml:"preload"`
+	SBOM             []string      `yaml:"sbom"`
+	LicensePolicy    LicensePolicy `yaml:"license_policy"`
+	Audit            Audit         `yaml:"audit"`
+	FailOnAbandoned  bool          `yaml:"fail_on_abandoned"`
+	Dev              bool          `yaml:"dev"`
+	DevTools         bool          `yaml:"dev_tools"`
+	VendorMode       string        `yaml:"vendor_mode"`
+	Prune            Prune         `yaml:"prune"`
 }
 
 type BuildpackYAML struct {
@@ -147,6 +355,11 @@ func LoadComposerBuildpackYAML(appRoot string) (BuildpackYAML, error) {
 
 	buildpackYAML.Composer.InstallOptions = []string{"--no-dev"}
 	buildpackYAML.Composer.VendorDirectory = "vendor"
+	buildpackYAML.Composer.VendorMode = VendorModeSymlink
+	buildpackYAML.Composer.RetryOnOOM = true
+	buildpackYAML.Composer.RetryMemoryLimit = "-1"
+	buildpackYAML.Composer.Audit.FailOn = "high"
+	buildpackYAML.Composer.Audit.UnknownSeverity = "medium"
 
 	if exists, err := helper.FileExists(configFile); err != nil {
 		return BuildpackYAML{}, err
@@ -167,5 +380,29 @@ func LoadComposerBuildpackYAML(appRoot string) (BuildpackYAML, error) {
 			return BuildpackYAML{}, err
 		}
 	}
+
+	if mirror, ok := os.LookupEnv("BP_COMPOSER_PACKAGIST_MIRROR"); ok {
+		buildpackYAML.Composer.PackagistMirror = mirror
+	}
+
+	if dev, ok := os.LookupEnv("BP_COMPOSER_DEV"); ok {
+		enabled, err := strconv.ParseBool(dev)
+		if err != nil {
+			return BuildpackYAML{}, fmt.Errorf("invalid BP_COMPOSER_DEV %q: %s", dev, err)
+		}
+		buildpackYAML.Composer.Dev = enabled
+	}
+
+	// dev mode installs require-dev, so --no-dev is dropped from the default or configured install options
+	if buildpackYAML.Composer.Dev {
+		options := []string{}
+		for _, option := range buildpackYAML.Composer.InstallOptions {
+			if option != "--no-dev" {
+				options = append(options, option)
+			}
+		}
+		buildpackYAML.Composer.InstallOptions = options
+	}
+
 	return buildpackYAML, nil
 }
@@ -2,6 +2,8 @@ package composer
 
 import (
 	"bytes"
+	"errors"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -12,6 +14,18 @@ import (
 	"github.com/sclevine/spec/report"
 )
 
+// outputRunner writes a message to Composer's captured output, like a real Composer run would
+type outputRunner struct {
+	*runner.FakeRunner
+	output  *bytes.Buffer
+	message string
+}
+
+func (r *outputRunner) Run(bin, dir string, args ...string) error {
+	r.output.WriteString(r.message)
+	return r.FakeRunner.Run(bin, dir, args...)
+}
+
 func TestUnitComposer(t *testing.T) {
 	spec.Run(t, "ComposerRunner", testComposer, spec.Report(report.Terminal{}))
 }
@@ -38,20 +52,79 @@ func testComposer(t *testing.T, when spec.G, it spec.S) {
 		})
 
 		it("should run composer -V", func() {
-			Expect(comp.Version()).To(Succeed())
+			fakeRunner.Out = bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20\n")
+
+			version, err := comp.Version()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version.String()).To(Equal("2.1.3"))
 			Expect(fakeRunner.Arguments).To(ConsistOf("php", expectedPharPath, "-V"))
 		})
 
+		it("should only run composer -V once", func() {
+			fakeRunner.Out = bytes.NewBufferString("Composer version 2.2.0 2021-12-22 22:21:31\n")
+
+			copied := comp
+			_, err := copied.Version()
+			Expect(err).NotTo(HaveOccurred())
+
+			version, err := comp.Version()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version.String()).To(Equal("2.2.0"))
+			Expect(fakeRunner.Calls).To(HaveLen(1))
+		})
+
+		it("should report the capabilities of the Composer version", func() {
+			fakeRunner.Out = bytes.NewBufferString("Composer version 2.2.6 2022-02-04 17:00:38\n")
+
+			Expect(comp.SupportsAllowPlugins()).To(BeTrue())
+			Expect(comp.SupportsAudit()).To(BeFalse())
+			Expect(comp.AtLeast("2.2.6")).To(BeTrue())
+		})
+
+		it("should return an error when the version cannot be determined", func() {
+			fakeRunner.Out = bytes.NewBufferString("")
+
+			_, err := comp.SupportsAudit()
+			Expect(err).To(MatchError(ContainSubstring("unable to find a Composer version")))
+		})
+
 		it("should run composer install", func() {
 			Expect(comp.Install("--foo", "--bar")).To(Succeed())
 			Expect(fakeRunner.Arguments).To(ConsistOf("php", expectedPharPath, "install", "--no-progress", "--foo", "--bar"))
 		})
 
+		it("should report when composer install runs out of memory", func() {
+			comp.Runner = &outputRunner{
+				FakeRunner: fakeRunner,
+				output:     comp.output,
+				message:    "PHP Fatal error:  Allowed memory size of 1610612736 bytes exhausted (tried to allocate 4096 bytes)",
+			}
+			fakeRunner.Err = errors.New("exit status 255")
+
+			err := comp.Install()
+			Expect(err).To(MatchError("composer ran out of memory: exit status 255"))
+			Expect(errors.As(err, &MemoryExhaustedError{})).To(BeTrue())
+		})
+
+		it("should pass through other composer install failures", func() {
+			comp.Runner = &outputRunner{FakeRunner: fakeRunner, output: comp.output, message: "Your requirements could not be resolved"}
+			fakeRunner.Err = errors.New("exit status 2")
+
+			err := comp.Install()
+			Expect(err).To(MatchError("exit status 2"))
+			Expect(errors.As(err, &MemoryExhaustedError{})).To(BeFalse())
+		})
+
 		it("should run composer global", func() {
 			Expect(comp.Global("--foo", "--bar")).To(Succeed())
 			Expect(fakeRunner.Arguments).To(ConsistOf("php", expectedPharPath, "global", "require", "--no-progress", "--foo", "--bar"))
 		})
 
+		it("should run composer run-script", func() {
+			Expect(comp.RunScript("post-install-cmd", "--no-dev")).To(Succeed())
+			Expect(fakeRunner.Arguments).To(Equal([]string{"php", expectedPharPath, "run-script", "post-install-cmd", "--no-dev"}))
+		})
+
 		it("should run config", func() {
 			Expect(comp.Config("github-oauth.github.com", "sec ret", true)).To(Succeed())
 			Expect(fakeRunner.Arguments).To(ConsistOf("php", expectedPharPath, "config", "-g", "github-oauth.github.com", `sec ret`))
@@ -61,6 +134,25 @@ func testComposer(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("parsing the output of composer -V", func() {
+		it("returns the version of Composer 2", func() {
+			version, err := ParseVersion("Composer version 2.1.3 2021-06-09 16:31:20\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version.String()).To(Equal("2.1.3"))
+		})
+
+		it("returns the version of Composer 1 with deprecation warnings", func() {
+			version, err := ParseVersion("Deprecation warning: require.Foo is invalid\nComposer version 1.10.22 2021-04-27 13:10:45\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version.String()).To(Equal("1.10.22"))
+		})
+
+		it("returns an error without a version", func() {
+			_, err := ParseVersion("Could not open input file: composer.phar\n")
+			Expect(err).To(MatchError(`unable to find a Composer version in "Could not open input file: composer.phar"`))
+		})
+	})
+
 	when("there is a composer.json in the app root", func() {
 		var compsoserPath string
 		it.Before(func() {
@@ -130,6 +222,8 @@ func testComposer(t *testing.T, when spec.G, it spec.S) {
 			Expect(bpYaml.Composer.JsonPath).To(Equal("subdir"))
 			Expect(bpYaml.Composer.VendorDirectory).To(Equal("vendor"))
 			Expect(bpYaml.Composer.InstallOptions).To(ConsistOf("--no-dev"))
+			Expect(bpYaml.Composer.RetryOnOOM).To(BeTrue())
+			Expect(bpYaml.Composer.RetryMemoryLimit).To(Equal("-1"))
 		})
 
 		it("loads and parses the file", func() {
@@ -149,6 +243,61 @@ func testComposer(t *testing.T, when spec.G, it spec.S) {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(bpYaml.Composer.InstallGlobal).To(ConsistOf("one", "two", "three"))
 		})
+
+		it("loads and parses the file with repositories", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"packagist_mirror": "https://mirror.example.com", "repositories": [{"name": "internal", "type": "vcs", "url": "https://git.example.com/lib.git"}]}}`)
+
+			bpYaml, err := LoadComposerBuildpackYAML(factory.Build.Application.Root)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bpYaml.Composer.PackagistMirror).To(Equal("https://mirror.example.com"))
+			Expect(bpYaml.Composer.DisablePackagist).To(BeFalse())
+			Expect(bpYaml.Composer.Repositories).To(Equal([]Repository{{Name: "internal", Type: "vcs", URL: "https://git.example.com/lib.git"}}))
+		})
+
+		it("loads and parses the file with php_ini", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"php_ini": {"extensions": ["intl"], "directives": {"memory_limit": "-1"}}}}`)
+
+			bpYaml, err := LoadComposerBuildpackYAML(factory.Build.Application.Root)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bpYaml.Composer.PhpIni.Extensions).To(ConsistOf("intl"))
+			Expect(bpYaml.Composer.PhpIni.Directives).To(Equal(map[string]string{"memory_limit": "-1"}))
+		})
+
+		it("overrides the packagist mirror from the environment", func() {
+			Expect(os.Setenv("BP_COMPOSER_PACKAGIST_MIRROR", "https://env.example.com")).To(Succeed())
+			defer os.Unsetenv("BP_COMPOSER_PACKAGIST_MIRROR")
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"packagist_mirror": "https://mirror.example.com"}}`)
+
+			bpYaml, err := LoadComposerBuildpackYAML(factory.Build.Application.Root)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bpYaml.Composer.PackagistMirror).To(Equal("https://env.example.com"))
+		})
+
+		it("drops --no-dev in dev mode", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"dev": true, "install_options": ["--no-dev", "--prefer-dist"]}}`)
+
+			bpYaml, err := LoadComposerBuildpackYAML(factory.Build.Application.Root)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bpYaml.Composer.InstallOptions).To(Equal([]string{"--prefer-dist"}))
+		})
+
+		it("enables dev mode from the environment", func() {
+			Expect(os.Setenv("BP_COMPOSER_DEV", "true")).To(Succeed())
+			defer os.Unsetenv("BP_COMPOSER_DEV")
+
+			bpYaml, err := LoadComposerBuildpackYAML(factory.Build.Application.Root)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bpYaml.Composer.Dev).To(BeTrue())
+			Expect(bpYaml.Composer.InstallOptions).To(BeEmpty())
+		})
+
+		it("rejects an invalid BP_COMPOSER_DEV", func() {
+			Expect(os.Setenv("BP_COMPOSER_DEV", "sometimes")).To(Succeed())
+			defer os.Unsetenv("BP_COMPOSER_DEV")
+
+			_, err := LoadComposerBuildpackYAML(factory.Build.Application.Root)
+			Expect(err).To(MatchError(ContainSubstring(`invalid BP_COMPOSER_DEV "sometimes"`)))
+		})
 	})
 
 	when("there are PHP extensions listed in composer.json", func() {
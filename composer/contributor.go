@@ -1,19 +1,26 @@
 package composer
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/cloudfoundry/libcfbuildpack/build"
 	"github.com/cloudfoundry/libcfbuildpack/helper"
 	"github.com/cloudfoundry/libcfbuildpack/layers"
+	"github.com/cloudfoundry/libcfbuildpack/services"
+	"github.com/paketo-buildpacks/php-composer/runner"
 	"github.com/paketo-buildpacks/php-web/config"
 )
 
 type Contributor struct {
 	ComposerLayer     layers.DependencyLayer
 	PhpLayer          layers.Layer
+	Runner            runner.Runner
 	buildContribution bool
+	services          services.Services
+	phpIni            PhpIni
 }
 
 func NewContributor(builder build.Build) (Contributor, bool, error) {
@@ -32,9 +39,17 @@ func NewContributor(builder build.Build) (Contributor, bool, error) {
 		return Contributor{}, false, err
 	}
 
+	buildpackYAML, err := LoadComposerBuildpackYAML(builder.Application.Root)
+	if err != nil {
+		return Contributor{}, false, err
+	}
+
 	contributor := Contributor{
 		ComposerLayer: builder.Layers.DependencyLayer(dep),
 		PhpLayer:      builder.Layers.Layer("php"),
+		Runner:        runner.ComposerRunner{Logger: builder.Logger},
+		services:      builder.Services,
+		phpIni:        buildpackYAML.Composer.PhpIni,
 	}
 
 	if _, ok := plan.Metadata["build"]; ok {
@@ -45,7 +60,12 @@ func NewContributor(builder build.Build) (Contributor, bool, error) {
 }
 
 func (n Contributor) Contribute() error {
-	return n.ComposerLayer.Contribute(func(artifact string, layer layers.DependencyLayer) error {
+	certs, err := NewCACertificates(n.services, filepath.Join(n.ComposerLayer.Root, CACertificatesBundle))
+	if err != nil {
+		return err
+	}
+
+	if err := n.ComposerLayer.Contribute(func(artifact string, layer layers.DependencyLayer) error {
 		layer.Logger.Body("Expanding to %s", layer.Root)
 
 		err := helper.CopyFile(artifact, filepath.Join(layer.Root, ComposerPHAR))
@@ -53,9 +73,42 @@ func (n Contributor) Contribute() error {
 			return err
 		}
 
+		if err := certs.WriteBundle(); err != nil {
+			return err
+		}
+
 		// generate temp php.ini for use by Composer during this buildpack
-		return n.writePhpIni()
-	}, n.flags()...)
+		if err := n.writePhpIni(certs); err != nil {
+			return err
+		}
+
+		return n.verifyComposer(layer)
+	}, n.flags()...); err != nil {
+		return err
+	}
+
+	return certs.Export()
+}
+
+// verifyComposer runs the installed composer.phar, so that a corrupt or mislabeled artifact fails this layer
+func (n Contributor) verifyComposer(layer layers.DependencyLayer) error {
+	output, err := n.Runner.RunWithOutput("php", layer.Root, "-c", filepath.Join(layer.Root, "composer-php.ini"), filepath.Join(layer.Root, ComposerPHAR), "-V")
+	if err != nil {
+		return fmt.Errorf("unable to run %s -V: %s", ComposerPHAR, err)
+	}
+
+	version, err := ParseVersion(output)
+	if err != nil {
+		return fmt.Errorf("unable to verify %s: %s", ComposerPHAR, err)
+	}
+
+	expected := layer.Dependency.Version.Version
+	if !version.Equal(expected) {
+		return fmt.Errorf("%s reports version %s, but version %s was expected from buildpack.toml", ComposerPHAR, version, expected)
+	}
+
+	layer.Logger.Body("Verified %s version %s", ComposerPHAR, version)
+	return nil
 }
 
 func (n Contributor) flags() []layers.Flag {
@@ -68,7 +121,7 @@ func (n Contributor) flags() []layers.Flag {
 	return flags
 }
 
-func (n Contributor) writePhpIni() error {
+func (n Contributor) writePhpIni(certs CACertificates) error {
 	phpIniCfg := config.PhpIniConfig{
 		PhpHome: os.Getenv("PHP_HOME"),
 		PhpAPI:  os.Getenv("PHP_API"),
@@ -78,10 +131,58 @@ func (n Contributor) writePhpIni() error {
 		},
 	}
 
+	for _, extension := range n.phpIni.Extensions {
+		if !contains(phpIniCfg.Extensions, extension) {
+			phpIniCfg.Extensions = append(phpIniCfg.Extensions, extension)
+		}
+	}
+
 	phpIniPath := filepath.Join(n.ComposerLayer.Root, "composer-php.ini")
 	if err := config.ProcessTemplateToFile(config.PhpIniTemplate, phpIniPath, phpIniCfg); err != nil {
 		return err
 	}
 
+	// directives from buildpack.yml take precedence over the CA certificates
+	directives := certs.IniDirectives()
+	for key, value := range n.phpIni.Directives {
+		directives[key] = value
+	}
+
+	return appendIniDirectives(phpIniPath, directives)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// appendIniDirectives adds directives to the end of a rendered php.ini, where they override earlier values
+func appendIniDirectives(path string, directives map[string]string) error {
+	if len(directives) == 0 {
+		return nil
+	}
+
+	keys := []string{}
+	for key := range directives {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(file, "%s = %s\n", key, directives[key]); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
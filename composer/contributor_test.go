@@ -1,21 +1,29 @@
 package composer_test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/cloudfoundry/libcfbuildpack/buildpackplan"
+	"github.com/cloudfoundry/libcfbuildpack/services"
 	"github.com/sclevine/spec/report"
 
 	"github.com/cloudfoundry/libcfbuildpack/test"
 	"github.com/paketo-buildpacks/php-composer/composer"
+	"github.com/paketo-buildpacks/php-composer/runner"
 	. "github.com/onsi/gomega"
 	"github.com/sclevine/spec"
 )
 
+// composerVersionOutput matches the version of the dependency added by test.BuildFactory.AddDependency
+const composerVersionOutput = "Composer version 1.0.0 2021-06-09 16:31:20"
+
 func TestUnitComposer(t *testing.T) {
 	spec.Run(t, "Composer", testContributor, spec.Report(report.Terminal{}))
 }
@@ -59,6 +67,7 @@ func testContributor(t *testing.T, when spec.G, it spec.S) {
 
 			composerDep, _, err := composer.NewContributor(f.Build)
 			Expect(err).NotTo(HaveOccurred())
+			composerDep.Runner = &runner.FakeRunner{Out: bytes.NewBufferString(composerVersionOutput)}
 
 			Expect(composerDep.Contribute()).To(Succeed())
 
@@ -73,5 +82,110 @@ func testContributor(t *testing.T, when spec.G, it spec.S) {
 			Expect(string(ini)).To(ContainSubstring("extension = openssl.so"))
 			Expect(string(ini)).To(ContainSubstring("extension = zlib.so"))
 		})
+
+		when("verifying composer.phar", func() {
+			var (
+				f          *test.BuildFactory
+				fakeRunner *runner.FakeRunner
+			)
+
+			it.Before(func() {
+				f = test.NewBuildFactory(t)
+				f.AddPlan(buildpackplan.Plan{Name: composer.Dependency})
+				f.AddDependencyWithVersion(composer.Dependency, "2.1.3", stubComposerFixture)
+				fakeRunner = &runner.FakeRunner{}
+			})
+
+			it("runs composer.phar -V with the php.ini used by Composer", func() {
+				fakeRunner.Out = bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20\n")
+
+				composerDep, _, err := composer.NewContributor(f.Build)
+				Expect(err).NotTo(HaveOccurred())
+				composerDep.Runner = fakeRunner
+
+				Expect(composerDep.Contribute()).To(Succeed())
+
+				layer := f.Build.Layers.Layer(composer.Dependency)
+				Expect(fakeRunner.Arguments).To(Equal([]string{"php", "-c", filepath.Join(layer.Root, "composer-php.ini"), filepath.Join(layer.Root, composer.ComposerPHAR), "-V"}))
+				Expect(fakeRunner.Cwd).To(Equal(layer.Root))
+			})
+
+			it("fails when the version does not match buildpack.toml", func() {
+				fakeRunner.Out = bytes.NewBufferString("Composer version 2.1.2 2021-06-07 16:03:06\n")
+
+				composerDep, _, err := composer.NewContributor(f.Build)
+				Expect(err).NotTo(HaveOccurred())
+				composerDep.Runner = fakeRunner
+
+				Expect(composerDep.Contribute()).To(MatchError("composer.phar reports version 2.1.2, but version 2.1.3 was expected from buildpack.toml"))
+			})
+
+			it("fails when the version cannot be parsed", func() {
+				fakeRunner.Out = bytes.NewBufferString("PHP Warning: garbage\n")
+
+				composerDep, _, err := composer.NewContributor(f.Build)
+				Expect(err).NotTo(HaveOccurred())
+				composerDep.Runner = fakeRunner
+
+				Expect(composerDep.Contribute()).To(MatchError(ContainSubstring(`unable to verify composer.phar: unable to find a Composer version in "PHP Warning: garbage"`)))
+			})
+
+			it("fails when composer.phar does not run", func() {
+				fakeRunner.Out = &bytes.Buffer{}
+				fakeRunner.Err = errors.New("exit status 255")
+
+				composerDep, _, err := composer.NewContributor(f.Build)
+				Expect(err).NotTo(HaveOccurred())
+				composerDep.Runner = fakeRunner
+
+				Expect(composerDep.Contribute()).To(MatchError("unable to run composer.phar -V: exit status 255"))
+			})
+		})
+
+		it("adds extensions and directives from buildpack.yml to the php.ini used by Composer", func() {
+			f := test.NewBuildFactory(t)
+			f.AddPlan(buildpackplan.Plan{Name: composer.Dependency})
+			f.AddDependency(composer.Dependency, stubComposerFixture)
+			test.WriteFile(t, filepath.Join(f.Build.Application.Root, "buildpack.yml"), `{"composer": {"php_ini": {"extensions": ["mbstring", "openssl", "intl"], "directives": {"memory_limit": "-1", "max_execution_time": "0"}}}}`)
+
+			composerDep, _, err := composer.NewContributor(f.Build)
+			Expect(err).NotTo(HaveOccurred())
+			composerDep.Runner = &runner.FakeRunner{Out: bytes.NewBufferString(composerVersionOutput)}
+
+			Expect(composerDep.Contribute()).To(Succeed())
+
+			layer := f.Build.Layers.Layer(composer.Dependency)
+			ini, err := ioutil.ReadFile(filepath.Join(layer.Root, "composer-php.ini"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(strings.Count(string(ini), "extension = openssl.so")).To(Equal(1))
+			Expect(string(ini)).To(ContainSubstring("extension = mbstring.so"))
+			Expect(string(ini)).To(ContainSubstring("extension = intl.so"))
+			Expect(string(ini)).To(HaveSuffix("max_execution_time = 0\nmemory_limit = -1\n"))
+			Expect(filepath.Join(f.Build.Application.Root, ".php.ini.d")).NotTo(BeAnExistingFile())
+		})
+
+		it("trusts the CA certificates from a ca-certificates binding", func() {
+			f := test.NewBuildFactory(t)
+			f.AddPlan(buildpackplan.Plan{Name: composer.Dependency})
+			f.AddDependency(composer.Dependency, stubComposerFixture)
+			f.AddService("ca-certificates", services.Credentials{"proxy.pem": "-----BEGIN CERTIFICATE-----\nproxy\n-----END CERTIFICATE-----"})
+			defer os.Unsetenv("SSL_CERT_FILE")
+
+			composerDep, _, err := composer.NewContributor(f.Build)
+			Expect(err).NotTo(HaveOccurred())
+			composerDep.Runner = &runner.FakeRunner{Out: bytes.NewBufferString(composerVersionOutput)}
+
+			Expect(composerDep.Contribute()).To(Succeed())
+
+			layer := f.Build.Layers.Layer(composer.Dependency)
+			bundle := filepath.Join(layer.Root, composer.CACertificatesBundle)
+			Expect(bundle).To(BeARegularFile())
+			Expect(os.Getenv("SSL_CERT_FILE")).To(Equal(bundle))
+
+			ini, err := ioutil.ReadFile(filepath.Join(layer.Root, "composer-php.ini"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(ini)).To(HaveSuffix(fmt.Sprintf("openssl.cafile = \"%s\"\n", bundle)))
+		})
 	})
 }
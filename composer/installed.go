@@ -0,0 +1,68 @@
+package composer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// InstalledJSON is the file in which Composer records the packages it installed to a vendor directory
+var InstalledJSON = filepath.Join("composer", "installed.json")
+
+// Installed is the content of vendor/composer/installed.json
+type Installed struct {
+	Packages        []LockPackage `json:"packages"`
+	Dev             bool          `json:"dev"`
+	DevPackageNames []string      `json:"dev-package-names"`
+}
+
+// LoadInstalled parses the installed.json at path, written by Composer 1 as a list of packages and by Composer 2 as an
+// object
+func LoadInstalled(path string) (Installed, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Installed{}, err
+	}
+
+	installed := Installed{}
+	if bytes.HasPrefix(bytes.TrimSpace(buf), []byte("[")) {
+		err = json.Unmarshal(buf, &installed.Packages)
+	} else {
+		err = json.Unmarshal(buf, &installed)
+	}
+
+	if err != nil {
+		return Installed{}, fmt.Errorf("unable to parse %s: %s", path, err)
+	}
+
+	return installed, nil
+}
+
+// Diff describes how the installed packages differ from the expected ones, or returns nothing when they match
+func (i Installed) Diff(expected []LockPackage) []string {
+	installed := map[string]string{}
+	for _, pkg := range i.Packages {
+		installed[pkg.Name] = pkg.Version
+	}
+
+	diff := []string{}
+	for _, pkg := range expected {
+		version, ok := installed[pkg.Name]
+		if !ok {
+			diff = append(diff, fmt.Sprintf("%s %s is not installed", pkg.Name, pkg.Version))
+		} else if version != pkg.Version {
+			diff = append(diff, fmt.Sprintf("%s %s is installed instead of %s", pkg.Name, version, pkg.Version))
+		}
+		delete(installed, pkg.Name)
+	}
+
+	for _, pkg := range i.Packages {
+		if _, ok := installed[pkg.Name]; ok {
+			diff = append(diff, fmt.Sprintf("%s %s is not in %s", pkg.Name, pkg.Version, ComposerLock))
+		}
+	}
+
+	return diff
+}
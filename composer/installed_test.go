@@ -0,0 +1,85 @@
+package composer_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitInstalled(t *testing.T) {
+	spec.Run(t, "Installed", testInstalled, spec.Report(report.Terminal{}))
+}
+
+func testInstalled(t *testing.T, when spec.G, it spec.S) {
+	var path string
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		path = filepath.Join(t.TempDir(), composer.InstalledJSON)
+	})
+
+	when("loading installed.json", func() {
+		it("parses the Composer 2 format", func() {
+			test.WriteFile(t, path, `{
+				"packages": [{"name": "monolog/monolog", "version": "2.3.5", "type": "library"}],
+				"dev": true,
+				"dev-package-names": ["phpunit/phpunit"]
+			}`)
+
+			installed, err := composer.LoadInstalled(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(installed).To(Equal(composer.Installed{
+				Packages:        []composer.LockPackage{{Name: "monolog/monolog", Version: "2.3.5", Type: "library"}},
+				Dev:             true,
+				DevPackageNames: []string{"phpunit/phpunit"},
+			}))
+		})
+
+		it("parses the Composer 1 format", func() {
+			test.WriteFile(t, path, `  [{"name": "monolog/monolog", "version": "1.26.1", "type": "library"}]`)
+
+			installed, err := composer.LoadInstalled(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(installed.Packages).To(Equal([]composer.LockPackage{{Name: "monolog/monolog", Version: "1.26.1", Type: "library"}}))
+		})
+
+		it("returns an error for an invalid installed.json", func() {
+			test.WriteFile(t, path, `{"packages": "none"}`)
+
+			_, err := composer.LoadInstalled(path)
+			Expect(err).To(MatchError(ContainSubstring("unable to parse")))
+		})
+	})
+
+	when("comparing installed packages", func() {
+		it("describes missing, mismatched and unexpected packages", func() {
+			installed := composer.Installed{Packages: []composer.LockPackage{
+				{Name: "monolog/monolog", Version: "2.3.4"},
+				{Name: "psr/log", Version: "1.1.4"},
+				{Name: "twig/twig", Version: "v3.3.8"},
+			}}
+
+			Expect(installed.Diff([]composer.LockPackage{
+				{Name: "monolog/monolog", Version: "2.3.5"},
+				{Name: "twig/twig", Version: "v3.3.8"},
+				{Name: "symfony/yaml", Version: "v5.4.3"},
+			})).To(Equal([]string{
+				"monolog/monolog 2.3.4 is installed instead of 2.3.5",
+				"symfony/yaml v5.4.3 is not installed",
+				"psr/log 1.1.4 is not in composer.lock",
+			}))
+		})
+
+		it("returns nothing when the packages match", func() {
+			installed := composer.Installed{Packages: []composer.LockPackage{{Name: "monolog/monolog", Version: "2.3.5"}}}
+
+			Expect(installed.Diff([]composer.LockPackage{{Name: "monolog/monolog", Version: "2.3.5"}})).To(BeEmpty())
+		})
+	})
+}
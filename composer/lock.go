@@ -0,0 +1,79 @@
+package composer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Lock is the subset of composer.lock used by the buildpack
+type Lock struct {
+	Packages    []LockPackage `json:"packages"`
+	PackagesDev []LockPackage `json:"packages-dev"`
+}
+
+// LockPackage is a package locked in composer.lock
+type LockPackage struct {
+	Name      string         `json:"name"`
+	Version   string         `json:"version"`
+	Type      string         `json:"type"`
+	License   []string       `json:"license,omitempty"`
+	Source    *LockReference `json:"source,omitempty"`
+	Dist      *LockReference `json:"dist,omitempty"`
+	Abandoned Abandoned      `json:"abandoned"`
+}
+
+// Abandoned is the `abandoned` field of a locked package, which is either true or the name of a replacement package
+type Abandoned struct {
+	Abandoned   bool
+	Replacement string
+}
+
+func (a *Abandoned) UnmarshalJSON(data []byte) error {
+	// json.Unmarshal leaves a string untouched for null, which Composer writes for maintained packages
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		*a = Abandoned{}
+		return nil
+	}
+
+	var replacement string
+	if err := json.Unmarshal(data, &replacement); err == nil {
+		*a = Abandoned{Abandoned: true, Replacement: replacement}
+		return nil
+	}
+
+	return json.Unmarshal(data, &a.Abandoned)
+}
+
+// LockReference is the source or dist a locked package is installed from
+type LockReference struct {
+	Type      string `json:"type"`
+	URL       string `json:"url"`
+	Reference string `json:"reference"`
+	Shasum    string `json:"shasum,omitempty"`
+}
+
+// LoadLock parses the composer.lock at path
+func LoadLock(path string) (Lock, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Lock{}, err
+	}
+
+	lock := Lock{}
+	if err := json.Unmarshal(buf, &lock); err != nil {
+		return Lock{}, fmt.Errorf("unable to parse %s: %s", path, err)
+	}
+
+	return lock, nil
+}
+
+// Installed returns the packages that `composer install` installs, which excludes packages-dev with --no-dev
+func (l Lock) Installed(dev bool) []LockPackage {
+	packages := append([]LockPackage{}, l.Packages...)
+	if dev {
+		packages = append(packages, l.PackagesDev...)
+	}
+	return packages
+}
@@ -0,0 +1,70 @@
+package composer_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitLock(t *testing.T) {
+	spec.Run(t, "Lock", testLock, spec.Report(report.Terminal{}))
+}
+
+func testLock(t *testing.T, when spec.G, it spec.S) {
+	var lockPath string
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		lockPath = filepath.Join(t.TempDir(), composer.ComposerLock)
+	})
+
+	when("loading composer.lock", func() {
+		it("returns the locked packages", func() {
+			test.WriteFile(t, lockPath, `{
+				"packages": [{"name": "monolog/monolog", "version": "2.3.5", "type": "library"}],
+				"packages-dev": [{"name": "phpunit/phpunit", "version": "9.5.10", "type": "library"}],
+				"platform": []
+			}`)
+
+			lock, err := composer.LoadLock(lockPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lock.Installed(false)).To(Equal([]composer.LockPackage{
+				{Name: "monolog/monolog", Version: "2.3.5", Type: "library"},
+			}))
+			Expect(lock.Installed(true)).To(HaveLen(2))
+		})
+
+		it("parses abandoned packages with and without a replacement", func() {
+			test.WriteFile(t, lockPath, `{
+				"packages": [
+					{"name": "swiftmailer/swiftmailer", "version": "v6.3.0", "abandoned": "symfony/mailer"},
+					{"name": "acme/unmaintained", "version": "1.0.0", "abandoned": true},
+					{"name": "monolog/monolog", "version": "2.3.5"},
+					{"name": "twig/twig", "version": "v3.3.4", "abandoned": null},
+					{"name": "psr/log", "version": "1.1.4", "abandoned": false}
+				]
+			}`)
+
+			lock, err := composer.LoadLock(lockPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lock.Packages[0].Abandoned).To(Equal(composer.Abandoned{Abandoned: true, Replacement: "symfony/mailer"}))
+			Expect(lock.Packages[1].Abandoned).To(Equal(composer.Abandoned{Abandoned: true}))
+			Expect(lock.Packages[2].Abandoned).To(Equal(composer.Abandoned{}))
+			Expect(lock.Packages[3].Abandoned).To(Equal(composer.Abandoned{}))
+			Expect(lock.Packages[4].Abandoned).To(Equal(composer.Abandoned{}))
+		})
+
+		it("returns an error for an invalid composer.lock", func() {
+			test.WriteFile(t, lockPath, `this is a lock file`)
+
+			_, err := composer.LoadLock(lockPath)
+			Expect(err).To(MatchError(ContainSubstring("unable to parse")))
+		})
+	})
+}
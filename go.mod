@@ -4,6 +4,7 @@ go 1.16
 
 require (
 	github.com/BurntSushi/toml v0.3.1
+	github.com/Masterminds/semver v1.5.0
 	github.com/buildpack/libbuildpack v1.25.11
 	github.com/cloudfoundry/dagger v0.0.0-20210428225900-2d0bc365c71a
 	github.com/cloudfoundry/libcfbuildpack v1.91.23
@@ -11,5 +12,6 @@ require (
 	github.com/paketo-buildpacks/occam v0.1.4
 	github.com/paketo-buildpacks/php-web v0.1.1
 	github.com/sclevine/spec v1.4.0
+	golang.org/x/sys v0.0.0-20210423082822-04245dca01da
 	gopkg.in/yaml.v2 v2.4.0
 )
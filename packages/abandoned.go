@@ -0,0 +1,62 @@
+package packages
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cloudfoundry/libcfbuildpack/helper"
+	"github.com/paketo-buildpacks/php-composer/composer"
+)
+
+// checkAbandoned warns about abandoned packages in composer.lock and their suggested replacements, failing the build
+// instead when fail_on_abandoned is set
+func (c Contributor) checkAbandoned() error {
+	lockPath := filepath.Join(c.composerDir, composer.ComposerLock)
+	if exists, err := helper.FileExists(lockPath); err != nil || !exists {
+		return err
+	}
+
+	lock, err := composer.LoadLock(lockPath)
+	if err != nil {
+		return err
+	}
+
+	table := bytes.Buffer{}
+	writer := tabwriter.NewWriter(&table, 0, 4, 2, ' ', 0)
+
+	abandoned := 0
+	for _, pkg := range lock.Installed(c.downloadsDev()) {
+		if !pkg.Abandoned.Abandoned {
+			continue
+		}
+		abandoned++
+
+		replacement := "no replacement suggested"
+		if pkg.Abandoned.Replacement != "" {
+			replacement = fmt.Sprintf("use %s instead", pkg.Abandoned.Replacement)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", pkg.Name, pkg.Version, replacement)
+	}
+
+	if abandoned == 0 {
+		return nil
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if c.composerBuildpackYAML.Composer.FailOnAbandoned {
+		return fmt.Errorf("%d abandoned packages are installed:\n%s", abandoned, table.String())
+	}
+
+	c.composer.Logger.BodyWarning("%d abandoned packages are installed, which no longer receive fixes:", abandoned)
+	for _, line := range strings.Split(strings.TrimRight(table.String(), "\n"), "\n") {
+		c.composer.Logger.Body("  %s", line)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package packages
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitAbandoned(t *testing.T) {
+	spec.Run(t, "Abandoned", testAbandoned, spec.Report(report.Terminal{}))
+}
+
+func testAbandoned(t *testing.T, when spec.G, it spec.S) {
+	var (
+		factory *test.BuildFactory
+		info    *bytes.Buffer
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		factory = test.NewBuildFactory(t)
+		info = &bytes.Buffer{}
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{
+			"packages": [
+				{"name": "monolog/monolog", "version": "2.3.5", "abandoned": false},
+				{"name": "swiftmailer/swiftmailer", "version": "v6.3.0", "abandoned": "symfony/mailer"},
+				{"name": "acme/unmaintained", "version": "1.0.0", "abandoned": true}
+			],
+			"packages-dev": [{"name": "acme/old-tool", "version": "0.1.0", "abandoned": true}]
+		}`)
+	})
+
+	it("warns about abandoned packages and their replacements", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {}}`, nil, info)
+
+		Expect(contributor.checkAbandoned()).To(Succeed())
+		Expect(info.String()).To(ContainSubstring("2 abandoned packages are installed, which no longer receive fixes"))
+		Expect(info.String()).To(ContainSubstring("swiftmailer/swiftmailer  v6.3.0  use symfony/mailer instead"))
+		Expect(info.String()).To(ContainSubstring("acme/unmaintained        1.0.0   no replacement suggested"))
+		Expect(info.String()).NotTo(ContainSubstring("acme/old-tool"))
+	})
+
+	it("fails in strict mode", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"install_options": [], "fail_on_abandoned": true}}`, nil, info)
+
+		err := contributor.checkAbandoned()
+		Expect(err).To(MatchError(ContainSubstring("3 abandoned packages are installed:\n")))
+		Expect(err).To(MatchError(ContainSubstring("acme/old-tool")))
+	})
+
+	it("reports dev packages when installing them to the dev tools layer", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"dev_tools": true}}`, nil, info)
+
+		Expect(contributor.checkAbandoned()).To(Succeed())
+		Expect(info.String()).To(ContainSubstring("acme/old-tool"))
+	})
+
+	it("does nothing without abandoned packages", func() {
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{"packages": [{"name": "monolog/monolog", "version": "2.3.5"}]}`)
+		contributor := newTestContributor(t, factory, `{"composer": {"fail_on_abandoned": true}}`, nil, info)
+
+		Expect(contributor.checkAbandoned()).To(Succeed())
+		Expect(info.String()).To(BeEmpty())
+	})
+}
@@ -0,0 +1,274 @@
+package packages
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/cloudfoundry/libcfbuildpack/helper"
+	"github.com/cloudfoundry/libcfbuildpack/layers"
+	"github.com/paketo-buildpacks/php-composer/composer"
+	"gopkg.in/yaml.v2"
+)
+
+// AdvisoryBindingType is the type of a binding whose `path` credential locates an advisory database
+const AdvisoryBindingType = "security-advisories"
+
+// severities orders the severities an advisory may declare, advisories without one count as audit.unknown_severity
+var severities = []string{"low", "medium", "high", "critical"}
+
+// versionComparisonPattern matches a comparison of an advisory branch, e.g. ">=2.0.0" or "<2.0.5"
+var versionComparisonPattern = regexp.MustCompile(`^\s*(<=|>=|<|>|==|=|!=)?\s*(\S+)\s*$`)
+
+// Advisory is a security advisory in the FriendsOfPHP/security-advisories format
+type Advisory struct {
+	Title     string                    `yaml:"title"`
+	Link      string                    `yaml:"link"`
+	CVE       string                    `yaml:"cve"`
+	Severity  string                    `yaml:"severity"`
+	Reference string                    `yaml:"reference"`
+	Branches  map[string]AdvisoryBranch `yaml:"branches"`
+}
+
+// AdvisoryBranch lists the constraints that together match the affected versions of a branch
+type AdvisoryBranch struct {
+	Versions []string `yaml:"versions"`
+}
+
+// Finding is an advisory that affects a locked package
+type Finding struct {
+	Package  composer.LockPackage
+	Advisory Advisory
+}
+
+// severity returns the rank of the advisory's severity in severities, or unknown when it declares none
+func (a Advisory) severity(unknown int) int {
+	if rank := severityRank(a.Severity); rank >= 0 {
+		return rank
+	}
+	return unknown
+}
+
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if strings.EqualFold(s, severity) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Affects reports whether a version is in any of the advisory's branches
+func (a Advisory) Affects(version string) (bool, error) {
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		// dev branches such as dev-main cannot be compared to advisories
+		return false, nil
+	}
+
+	for _, branch := range a.Branches {
+		if len(branch.Versions) == 0 {
+			return false, fmt.Errorf("invalid versions %v in advisory %q: no versions", branch.Versions, a.Title)
+		}
+
+		affected := true
+		for _, comparison := range branch.Versions {
+			matches, err := compareVersion(v, comparison)
+			if err != nil {
+				return false, fmt.Errorf("invalid versions %v in advisory %q: %s", branch.Versions, a.Title, err)
+			}
+			affected = affected && matches
+		}
+
+		if affected {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// compareVersion reports whether a version satisfies a comparison of an advisory branch. Unlike semver constraints,
+// which never match prereleases unless they name one, it orders prereleases before their release, so that
+// 2.0.0-beta1 satisfies <2.0.0.
+func compareVersion(v *semver.Version, comparison string) (bool, error) {
+	matches := versionComparisonPattern.FindStringSubmatch(comparison)
+	if matches == nil {
+		return false, fmt.Errorf("invalid comparison %q", comparison)
+	}
+
+	bound, err := semver.NewVersion(matches[2])
+	if err != nil {
+		return false, err
+	}
+
+	result := v.Compare(bound)
+	switch matches[1] {
+	case "<":
+		return result < 0, nil
+	case "<=":
+		return result <= 0, nil
+	case ">":
+		return result > 0, nil
+	case ">=":
+		return result >= 0, nil
+	case "!=":
+		return result != 0, nil
+	default:
+		return result == 0, nil
+	}
+}
+
+// LoadAdvisories reads the advisories of a database directory by the name of the package they affect
+func LoadAdvisories(root string) (map[string][]Advisory, error) {
+	advisories := map[string][]Advisory{}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || (filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml") {
+			return nil
+		}
+
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		advisory := Advisory{}
+		if err := yaml.Unmarshal(buf, &advisory); err != nil {
+			return fmt.Errorf("unable to parse advisory %s: %s", path, err)
+		}
+
+		if name := strings.TrimPrefix(advisory.Reference, "composer://"); name != advisory.Reference {
+			advisories[name] = append(advisories[name], advisory)
+		}
+
+		return nil
+	})
+
+	return advisories, err
+}
+
+// advisoryDatabase locates the advisory database from a binding, buildpack.yml or the buildpack's dependencies, in that
+// order
+func (c Contributor) advisoryDatabase() (string, error) {
+	for _, binding := range c.services.Services {
+		if composer.IsBindingType(binding, AdvisoryBindingType) {
+			if path, ok := binding.Credentials["path"].(string); ok && path != "" {
+				return path, nil
+			}
+			return "", fmt.Errorf("the %s binding %s requires a path credential", AdvisoryBindingType, binding.BindingName)
+		}
+	}
+
+	if database := c.composerBuildpackYAML.Composer.Audit.Database; database != "" {
+		if filepath.IsAbs(database) {
+			return database, nil
+		}
+		return filepath.Join(c.app.Root, database), nil
+	}
+
+	if c.advisoryLayer != nil {
+		if err := c.advisoryLayer.Contribute(func(artifact string, layer layers.DependencyLayer) error {
+			layer.Logger.Body("Expanding to %s", layer.Root)
+			return helper.ExtractTarGz(artifact, layer.Root, 1)
+		}, layers.Build, layers.Cache); err != nil {
+			return "", err
+		}
+		return c.advisoryLayer.Root, nil
+	}
+
+	return "", fmt.Errorf("audit requires an advisory database from a %s binding, audit.database or the buildpack", AdvisoryBindingType)
+}
+
+// auditPackages reports the advisories that affect packages in composer.lock by severity, and fails when any reach
+// audit.fail_on. It runs before `composer install` and never needs network access.
+func (c Contributor) auditPackages() error {
+	cfg := c.composerBuildpackYAML.Composer.Audit
+	if !cfg.Enabled {
+		return nil
+	}
+
+	threshold := severityRank(cfg.FailOn)
+	if threshold < 0 && cfg.FailOn != "none" {
+		return fmt.Errorf("invalid audit.fail_on %q, use one of %s or none", cfg.FailOn, strings.Join(severities, ", "))
+	}
+
+	unknown := severityRank(cfg.UnknownSeverity)
+	if unknown < 0 {
+		return fmt.Errorf("invalid audit.unknown_severity %q, use one of %s", cfg.UnknownSeverity, strings.Join(severities, ", "))
+	}
+
+	lockPath := filepath.Join(c.composerDir, composer.ComposerLock)
+	if exists, err := helper.FileExists(lockPath); err != nil {
+		return err
+	} else if !exists {
+		c.composer.Logger.BodyWarning("Not auditing packages, as there is no %s", composer.ComposerLock)
+		return nil
+	}
+
+	lock, err := composer.LoadLock(lockPath)
+	if err != nil {
+		return err
+	}
+
+	database, err := c.advisoryDatabase()
+	if err != nil {
+		return err
+	}
+
+	advisories, err := LoadAdvisories(database)
+	if err != nil {
+		return err
+	}
+
+	findings := []Finding{}
+	for _, pkg := range lock.Installed(c.downloadsDev()) {
+		for _, advisory := range advisories[pkg.Name] {
+			if affected, err := advisory.Affects(pkg.Version); err != nil {
+				return err
+			} else if affected {
+				findings = append(findings, Finding{pkg, advisory})
+			}
+		}
+	}
+
+	if len(findings) == 0 {
+		c.composer.Logger.Body("No security advisories affect the installed packages")
+		return nil
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Advisory.severity(unknown) > findings[j].Advisory.severity(unknown)
+	})
+
+	failing := 0
+	for _, finding := range findings {
+		advisory := finding.Advisory
+		severity := severities[advisory.severity(unknown)]
+		if threshold >= 0 && advisory.severity(unknown) >= threshold {
+			failing++
+		}
+
+		id := advisory.CVE
+		if id == "" {
+			id = advisory.Link
+		}
+
+		c.composer.Logger.BodyWarning("[%s] %s %s: %s (%s)", strings.ToUpper(severity), finding.Package.Name, finding.Package.Version, advisory.Title, id)
+	}
+
+	if failing > 0 {
+		return fmt.Errorf("%d security advisories at or above severity %s affect the installed packages", failing, cfg.FailOn)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package packages
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/libcfbuildpack/services"
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitAudit(t *testing.T) {
+	spec.Run(t, "Audit", testAudit, spec.Report(report.Terminal{}))
+}
+
+func testAudit(t *testing.T, when spec.G, it spec.S) {
+	var (
+		factory  *test.BuildFactory
+		database string
+		info     *bytes.Buffer
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		factory = test.NewBuildFactory(t)
+		info = &bytes.Buffer{}
+		database = filepath.Join(factory.Build.Application.Root, "advisories")
+
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{
+			"packages": [
+				{"name": "monolog/monolog", "version": "2.3.4"},
+				{"name": "symfony/http-kernel", "version": "v5.4.2"},
+				{"name": "twig/twig", "version": "v3.3.8"}
+			],
+			"packages-dev": [{"name": "phpunit/phpunit", "version": "8.5.0"}]
+		}`)
+
+		test.WriteFile(t, filepath.Join(database, "monolog", "monolog", "CVE-2000-0001.yaml"), `
+title:     Log injection
+link:      https://example.com/monolog
+cve:       CVE-2000-0001
+severity:  medium
+branches:
+    2.x:
+        time:     2021-10-01 00:00:00
+        versions: ['>=2.0.0', '<2.3.5']
+reference: composer://monolog/monolog
+`)
+		test.WriteFile(t, filepath.Join(database, "symfony", "http-kernel", "CVE-2000-0002.yaml"), `
+title:     Remote code execution
+link:      https://example.com/http-kernel
+cve:       CVE-2000-0002
+branches:
+    4.4.x:
+        versions: ['>=4.4.0', '<4.4.50']
+    5.4.x:
+        versions: ['>=5.4.0', '<5.4.20']
+reference: composer://symfony/http-kernel
+`)
+		test.WriteFile(t, filepath.Join(database, "twig", "twig", "2000-01-01.yaml"), `
+title:     Fixed long ago
+link:      https://example.com/twig
+severity:  critical
+branches:
+    1.x:
+        versions: ['<1.38.0']
+reference: composer://twig/twig
+`)
+		test.WriteFile(t, filepath.Join(database, "phpunit", "phpunit", "CVE-2017-9841.yaml"), `
+title:     RCE in eval-stdin.php
+link:      https://example.com/phpunit
+cve:       CVE-2017-9841
+severity:  critical
+branches:
+    8.x:
+        versions: ['>=8.0.0', '<8.5.1']
+reference: composer://phpunit/phpunit
+`)
+	})
+
+	it("reports advisories by severity and fails at the threshold", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"audit": {"enabled": true, "database": "advisories", "unknown_severity": "high"}}}`, nil, info)
+
+		Expect(contributor.auditPackages()).To(MatchError("1 security advisories at or above severity high affect the installed packages"))
+		Expect(info.String()).To(ContainSubstring("[HIGH] symfony/http-kernel v5.4.2: Remote code execution (CVE-2000-0002)"))
+		Expect(info.String()).To(ContainSubstring("[MEDIUM] monolog/monolog 2.3.4: Log injection (CVE-2000-0001)"))
+		Expect(info.String()).NotTo(ContainSubstring("twig"))
+		Expect(info.String()).NotTo(ContainSubstring("phpunit"))
+		Expect(info.String()).To(MatchRegexp(`(?s)HIGH.*MEDIUM`))
+	})
+
+	it("counts advisories without a severity as medium by default", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"audit": {"enabled": true, "database": "advisories"}}}`, nil, info)
+
+		Expect(contributor.auditPackages()).To(Succeed())
+		Expect(info.String()).To(ContainSubstring("[MEDIUM] symfony/http-kernel v5.4.2: Remote code execution (CVE-2000-0002)"))
+	})
+
+	it("rejects an invalid severity for advisories without one", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"audit": {"enabled": true, "database": "advisories", "unknown_severity": "unknown"}}}`, nil, info)
+
+		Expect(contributor.auditPackages()).To(MatchError(`invalid audit.unknown_severity "unknown", use one of low, medium, high, critical`))
+	})
+
+	it("matches prerelease versions", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"audit": {"enabled": true, "database": "advisories", "fail_on": "medium"}}}`, nil, info)
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{
+			"packages": [{"name": "monolog/monolog", "version": "2.3.5-RC1"}]
+		}`)
+
+		Expect(contributor.auditPackages()).To(MatchError(ContainSubstring("1 security advisories")))
+		Expect(info.String()).To(ContainSubstring("[MEDIUM] monolog/monolog 2.3.5-RC1: Log injection"))
+	})
+
+	it("compares prereleases before their release", func() {
+		advisory := Advisory{Branches: map[string]AdvisoryBranch{"2.x": {Versions: []string{">=2.0.0", "<2.1.0"}}}}
+
+		Expect(advisory.Affects("2.0.0-beta1")).To(BeFalse())
+		Expect(advisory.Affects("v2.0.1-beta1")).To(BeTrue())
+		Expect(advisory.Affects("2.1.0-RC1")).To(BeTrue())
+		Expect(advisory.Affects("2.1.0")).To(BeFalse())
+		Expect(advisory.Affects("dev-main")).To(BeFalse())
+
+		_, err := Advisory{Title: "Broken", Branches: map[string]AdvisoryBranch{"2.x": {Versions: []string{"~2"}}}}.Affects("2.0.0")
+		Expect(err).To(MatchError(ContainSubstring(`invalid versions [~2] in advisory "Broken"`)))
+	})
+
+	it("only reports findings below the threshold", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"audit": {"enabled": true, "database": "advisories", "fail_on": "critical"}}}`, nil, info)
+
+		Expect(contributor.auditPackages()).To(Succeed())
+		Expect(info.String()).To(ContainSubstring("symfony/http-kernel"))
+	})
+
+	it("audits dev packages when installing them", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"install_options": [], "audit": {"enabled": true, "database": "advisories", "fail_on": "critical"}}}`, nil, info)
+
+		Expect(contributor.auditPackages()).To(MatchError(ContainSubstring("1 security advisories at or above severity critical")))
+	})
+
+	it("audits dev packages when installing them to the dev tools layer", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"dev_tools": true, "audit": {"enabled": true, "database": "advisories", "fail_on": "critical"}}}`, nil, info)
+
+		Expect(contributor.auditPackages()).To(MatchError(ContainSubstring("1 security advisories at or above severity critical")))
+	})
+
+	it("never fails with fail_on none", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"audit": {"enabled": true, "database": "advisories", "fail_on": "none"}}}`, nil, info)
+
+		Expect(contributor.auditPackages()).To(Succeed())
+	})
+
+	it("reads the database path from a binding", func() {
+		factory.AddService(AdvisoryBindingType, services.Credentials{"path": database})
+		contributor := newTestContributor(t, factory, `{"composer": {"audit": {"enabled": true, "database": "missing"}}}`, nil, info)
+
+		Expect(contributor.auditPackages()).To(Succeed())
+		Expect(info.String()).To(ContainSubstring("symfony/http-kernel"))
+	})
+
+	it("rejects an invalid threshold", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"audit": {"enabled": true, "database": "advisories", "fail_on": "severe"}}}`, nil, info)
+
+		Expect(contributor.auditPackages()).To(MatchError(`invalid audit.fail_on "severe", use one of low, medium, high, critical or none`))
+	})
+
+	it("requires an advisory database", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"audit": {"enabled": true}}}`, nil, info)
+
+		Expect(contributor.auditPackages()).To(MatchError(ContainSubstring("audit requires an advisory database")))
+	})
+
+	it("does nothing unless enabled", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"audit": {"database": "advisories"}}}`, nil, info)
+
+		Expect(contributor.auditPackages()).To(Succeed())
+		Expect(info.String()).To(BeEmpty())
+	})
+}
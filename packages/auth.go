@@ -0,0 +1,101 @@
+package packages
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/cloudfoundry/libcfbuildpack/helper"
+	"github.com/cloudfoundry/libcfbuildpack/services"
+	"github.com/paketo-buildpacks/php-composer/composer"
+)
+
+const (
+	// AuthBindingType is the type of service binding that supplies Composer credentials
+	AuthBindingType = "composer"
+	AuthJSON        = "auth.json"
+)
+
+// authKeys are the auth.json sections that may be supplied through a binding
+var authKeys = []string{"http-basic", "bearer", "gitlab-token", "bitbucket-oauth"}
+
+// ComposerAuth is the content of a Composer auth.json file, keyed by section and then by host
+type ComposerAuth map[string]map[string]interface{}
+
+// NewComposerAuth merges the credentials of every `composer` service binding into a single auth.json
+func NewComposerAuth(bindings services.Services) (ComposerAuth, error) {
+	auth := ComposerAuth{}
+
+	for _, binding := range bindings.Services {
+		if !composer.IsBindingType(binding, AuthBindingType) {
+			continue
+		}
+
+		for _, key := range authKeys {
+			value, ok := binding.Credentials[key]
+			if !ok {
+				continue
+			}
+
+			hosts, err := parseAuthSection(value)
+			if err != nil {
+				return ComposerAuth{}, fmt.Errorf("unable to parse %q from binding %q: %s", key, binding.BindingName, err)
+			}
+
+			if _, ok := auth[key]; !ok {
+				auth[key] = map[string]interface{}{}
+			}
+
+			for host, credentials := range hosts {
+				auth[key][host] = credentials
+			}
+		}
+	}
+
+	return auth, nil
+}
+
+// Hosts returns the hosts that credentials are configured for, sorted for stable logging
+func (a ComposerAuth) Hosts() []string {
+	hosts := []string{}
+	for _, section := range a {
+		for host := range section {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Write writes auth.json to the given COMPOSER_HOME, readable only by the current user
+func (a ComposerAuth) Write(composerHome string) error {
+	buf, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	return helper.WriteFile(filepath.Join(composerHome, AuthJSON), 0600, string(buf))
+}
+
+// parseAuthSection accepts either a structured value or the raw JSON string of a single auth.json section
+func parseAuthSection(value interface{}) (map[string]interface{}, error) {
+	var buf []byte
+
+	switch v := value.(type) {
+	case string:
+		buf = []byte(v)
+	default:
+		var err error
+		if buf, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+
+	hosts := map[string]interface{}{}
+	if err := json.Unmarshal(buf, &hosts); err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
@@ -0,0 +1,112 @@
+package packages
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/libcfbuildpack/services"
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitComposerAuth(t *testing.T) {
+	spec.Run(t, "ComposerAuth", testComposerAuth, spec.Report(report.Terminal{}))
+}
+
+func testComposerAuth(t *testing.T, when spec.G, it spec.S) {
+	var factory *test.BuildFactory
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		factory = test.NewBuildFactory(t)
+	})
+
+	when("there are composer service bindings", func() {
+		it("merges the credentials of every binding", func() {
+			factory.AddService("composer", services.Credentials{
+				"http-basic": map[string]interface{}{
+					"repo.example.com": map[string]interface{}{"username": "user", "password": "pass"},
+				},
+				"bearer": `{"satis.example.com": "bearer-token"}`,
+			})
+			factory.AddService("gitlab", services.Credentials{
+				"gitlab-token": map[string]interface{}{"gitlab.example.com": "gitlab-token"},
+			}, "composer")
+			factory.AddService("mysql", services.Credentials{
+				"bearer": map[string]interface{}{"db.example.com": "not-composer"},
+			})
+
+			auth, err := NewComposerAuth(factory.Build.Services)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(auth.Hosts()).To(Equal([]string{"gitlab.example.com", "repo.example.com", "satis.example.com"}))
+			Expect(auth["bearer"]).To(HaveKeyWithValue("satis.example.com", "bearer-token"))
+			Expect(auth["gitlab-token"]).To(HaveKeyWithValue("gitlab.example.com", "gitlab-token"))
+			Expect(auth).NotTo(HaveKey("bitbucket-oauth"))
+		})
+
+		it("returns an error when a section is malformed", func() {
+			factory.AddService("composer", services.Credentials{"bearer": "not json"})
+
+			_, err := NewComposerAuth(factory.Build.Services)
+			Expect(err).To(MatchError(ContainSubstring(`unable to parse "bearer" from binding "composer"`)))
+		})
+	})
+
+	when("contributing credentials", func() {
+		var composerHome string
+
+		it.Before(func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+
+			var err error
+			composerHome, err = ioutil.TempDir("", "composer-home")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		it.After(func() {
+			Expect(os.RemoveAll(composerHome)).To(Succeed())
+		})
+
+		it("writes auth.json to COMPOSER_HOME", func() {
+			factory.AddService("composer", services.Credentials{
+				"bitbucket-oauth": map[string]interface{}{
+					"bitbucket.org": map[string]interface{}{"consumer-key": "key", "consumer-secret": "secret"},
+				},
+			})
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composerHome = composerHome
+
+			Expect(contributor.configureComposerAuth()).To(Succeed())
+
+			authPath := filepath.Join(contributor.composerHome, AuthJSON)
+			info, err := os.Stat(authPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			contents, err := ioutil.ReadFile(authPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			auth := ComposerAuth{}
+			Expect(json.Unmarshal(contents, &auth)).To(Succeed())
+			Expect(auth["bitbucket-oauth"]).To(HaveKey("bitbucket.org"))
+		})
+
+		it("does not write auth.json without bindings", func() {
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composerHome = composerHome
+
+			Expect(contributor.configureComposerAuth()).To(Succeed())
+			Expect(filepath.Join(contributor.composerHome, AuthJSON)).NotTo(BeAnExistingFile())
+		})
+	})
+}
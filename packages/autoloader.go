@@ -0,0 +1,81 @@
+package packages
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/paketo-buildpacks/php-composer/composer"
+)
+
+const noAutoloaderOption = "--no-autoloader"
+
+// autoloaderFlags maps the autoloader config to flags for `composer install`, or `composer dump-autoload` which names
+// them differently
+func autoloaderFlags(autoloader composer.Autoloader, dumpAutoload bool) []string {
+	flags := []string{}
+
+	if autoloader.Optimize {
+		if dumpAutoload {
+			flags = append(flags, "--optimize")
+		} else {
+			flags = append(flags, "--optimize-autoloader")
+		}
+	}
+
+	if autoloader.Authoritative {
+		flags = append(flags, "--classmap-authoritative")
+	}
+
+	if autoloader.APCu {
+		if dumpAutoload {
+			flags = append(flags, "--apcu")
+		} else {
+			flags = append(flags, "--apcu-autoloader")
+		}
+	}
+
+	return flags
+}
+
+// checkAutoloader rejects conflicting autoloader settings and warns when APCu is requested but not enabled
+func (c Contributor) checkAutoloader() error {
+	autoloader := c.composerBuildpackYAML.Composer.Autoloader
+
+	if autoloader.Authoritative && autoloader.APCu {
+		return fmt.Errorf("autoloader.apcu has no effect with autoloader.authoritative, which never looks up classes outside the classmap")
+	}
+
+	if !autoloader.APCu {
+		return nil
+	}
+
+	modules, err := c.composer.Runner.RunWithOutput("php", c.app.Root, "-m")
+	if err != nil {
+		return err
+	}
+
+	for _, module := range strings.Split(modules, "\n") {
+		if strings.EqualFold(strings.TrimSpace(module), "apcu") {
+			return nil
+		}
+	}
+
+	c.composer.Logger.BodyWarning("autoloader.apcu is enabled, but the apcu extension is not. " +
+		"Composer's APCu autoloader has no effect unless composer.json requires `ext-apcu` or apcu is enabled in `.php.ini.d`.")
+	return nil
+}
+
+// dumpAutoload generates the configured autoloader when `composer install` ran with --no-autoloader
+func (c Contributor) dumpAutoload(options []string) error {
+	autoloader := c.composerBuildpackYAML.Composer.Autoloader
+	if !containsOption(options, noAutoloaderOption) || autoloader == (composer.Autoloader{}) {
+		return nil
+	}
+
+	args := autoloaderFlags(autoloader, true)
+	if !c.installsDev() {
+		args = append(args, "--no-dev")
+	}
+
+	return c.composer.DumpAutoload(args...)
+}
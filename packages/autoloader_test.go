@@ -0,0 +1,84 @@
+package packages
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+	"github.com/paketo-buildpacks/php-composer/runner"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitAutoloader(t *testing.T) {
+	spec.Run(t, "Autoloader", testAutoloader, spec.Report(report.Terminal{}))
+}
+
+func testAutoloader(t *testing.T, when spec.G, it spec.S) {
+	var (
+		factory    *test.BuildFactory
+		fakeRunner *runner.FakeRunner
+		info       *bytes.Buffer
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		factory = test.NewBuildFactory(t)
+		fakeRunner = &runner.FakeRunner{Out: bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20")}
+		info = &bytes.Buffer{}
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+	})
+
+	when("autoloader optimizations are configured", func() {
+		it("adds the matching install flags", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"install_options": ["--no-dev", "--optimize-autoloader"], "autoloader": {"optimize": true, "authoritative": true}}}`, fakeRunner, info)
+
+			Expect(contributor.installOptions()).To(Equal([]string{"--no-dev", "--optimize-autoloader", "--classmap-authoritative"}))
+		})
+
+		it("runs dump-autoload when installing with --no-autoloader", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"install_options": ["--no-dev", "--no-autoloader"], "autoloader": {"optimize": true, "apcu": true}}}`, fakeRunner, info)
+
+			options, err := contributor.installOptions()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(options).To(Equal([]string{"--no-dev", "--no-autoloader"}))
+
+			Expect(contributor.dumpAutoload(options)).To(Succeed())
+			Expect(fakeRunner.Arguments).To(Equal([]string{"php", filepath.Join("/tmp", composer.ComposerPHAR), "dump-autoload", "--optimize", "--apcu", "--no-dev"}))
+		})
+
+		it("does not run dump-autoload without --no-autoloader", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"autoloader": {"optimize": true}}}`, fakeRunner, info)
+
+			Expect(contributor.dumpAutoload([]string{"--no-dev", "--optimize-autoloader"})).To(Succeed())
+			Expect(fakeRunner.Calls).To(BeEmpty())
+		})
+
+		it("rejects apcu with an authoritative classmap", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"autoloader": {"authoritative": true, "apcu": true}}}`, fakeRunner, info)
+
+			Expect(contributor.checkAutoloader()).To(MatchError(ContainSubstring("autoloader.apcu has no effect with autoloader.authoritative")))
+		})
+
+		it("warns when apcu is requested but not enabled", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"autoloader": {"apcu": true}}}`, fakeRunner, info)
+			fakeRunner.Out = bytes.NewBufferString("[PHP Modules]\nCore\nopenssl\nzlib\n\n[Zend Modules]\n")
+
+			Expect(contributor.checkAutoloader()).To(Succeed())
+			Expect(fakeRunner.Arguments).To(Equal([]string{"php", "-m"}))
+			Expect(info.String()).To(ContainSubstring("autoloader.apcu is enabled, but the apcu extension is not"))
+		})
+
+		it("does not warn when apcu is enabled", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"autoloader": {"apcu": true}}}`, fakeRunner, info)
+			fakeRunner.Out = bytes.NewBufferString("[PHP Modules]\napcu\nCore\n")
+
+			Expect(contributor.checkAutoloader()).To(Succeed())
+			Expect(info.String()).To(BeEmpty())
+		})
+	})
+}
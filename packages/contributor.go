@@ -4,24 +4,31 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/buildpack/libbuildpack/application"
 	"github.com/cloudfoundry/libcfbuildpack/build"
 	"github.com/cloudfoundry/libcfbuildpack/helper"
 	"github.com/cloudfoundry/libcfbuildpack/layers"
+	"github.com/cloudfoundry/libcfbuildpack/services"
 	"github.com/paketo-buildpacks/php-composer/composer"
 	"github.com/paketo-buildpacks/php-web/config"
 )
 
+const packagistRepositoryKey = "repositories.packagist.org"
+
 type Metadata struct {
-	Name string
-	Hash string
+	Name     string
+	Hash     string
+	Settings string
 }
 
 func (m Metadata) Identity() (name string, version string) {
@@ -33,9 +40,15 @@ type Contributor struct {
 	composerLayer         layers.Layer
 	composerPackagesLayer layers.Layer
 	cacheLayer            layers.Layer
+	sbomLayer             layers.Layer
+	devToolsLayer         layers.Layer
+	advisoryLayer         *layers.DependencyLayer
 	composerMetadata      Metadata
 	composer              composer.Composer
 	composerBuildpackYAML composer.BuildpackYAML
+	composerHome          string
+	composerDir           string
+	services              services.Services
 }
 
 func generateRandomHash() [32]byte {
@@ -72,14 +85,48 @@ func NewContributor(context build.Build, composerPharPath string) (Contributor,
 		hash = generateRandomHash()
 	}
 
+	// dev and production packages are cached under different keys, so switching modes never reuses the wrong set, and
+	// so are copied packages, since a symlinked layer from the previous build is launch-only and not restored
+	settings, err := installSettings(buildpackYAML.Composer)
+	if err != nil {
+		return Contributor{}, false, err
+	}
+
+	metadata := Metadata{Name: "PHP Composer", Hash: hex.EncodeToString(hash[:]), Settings: settings}
+	if buildpackYAML.Composer.Dev {
+		metadata.Name = "PHP Composer (dev)"
+	} else if buildpackYAML.Composer.VendorMode == composer.VendorModeCopy {
+		metadata.Name = "PHP Composer (copy)"
+	}
+
 	contributor := Contributor{
 		app:                   context.Application,
 		composerLayer:         context.Layers.Layer(composer.Dependency),
 		composerPackagesLayer: context.Layers.Layer(composer.PackagesDependency),
 		cacheLayer:            context.Layers.Layer(composer.CacheDependency),
-		composerMetadata:      Metadata{"PHP Composer", hex.EncodeToString(hash[:])},
+		sbomLayer:             context.Layers.Layer(composer.SBOMDependency),
+		devToolsLayer:         context.Layers.Layer(composer.DevToolsDependency),
+		composerMetadata:      metadata,
 		composer:              composer.NewComposer(composerDir, composerPharPath, context.Logger),
 		composerBuildpackYAML: buildpackYAML,
+		composerDir:           composerDir,
+		services:              context.Services,
+	}
+
+	// operators may ship an advisory database for auditing packages as a dependency of the buildpack
+	deps, err := context.Buildpack.Dependencies()
+	if err != nil {
+		return Contributor{}, false, err
+	}
+
+	if deps.Has(composer.AdvisoryDependency) {
+		dep, err := deps.Best(composer.AdvisoryDependency, "*", context.Stack)
+		if err != nil {
+			return Contributor{}, false, err
+		}
+
+		layer := context.Layers.DependencyLayer(dep)
+		contributor.advisoryLayer = &layer
 	}
 
 	if err := contributor.initializeEnv(buildpackYAML.Composer.VendorDirectory); err != nil {
@@ -89,6 +136,24 @@ func NewContributor(context build.Build, composerPharPath string) (Contributor,
 	return contributor, true, nil
 }
 
+// installSettings hashes the buildpack.yml settings that change what `composer install` writes to the packages layer,
+// so that changing them rebuilds the layer even when composer.lock is unchanged
+func installSettings(cfg composer.ComposerConfig) (string, error) {
+	settings, err := json.Marshal(struct {
+		InstallOptions []string
+		NoScripts      bool
+		AllowedScripts []string
+		Autoloader     composer.Autoloader
+		Prune          composer.Prune
+	}{cfg.InstallOptions, cfg.NoScripts, cfg.AllowedScripts, cfg.Autoloader, cfg.Prune})
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(settings)
+	return hex.EncodeToString(hash[:]), nil
+}
+
 func (c Contributor) SetupVendorDir() error {
 	composerLayerVendorDir := filepath.Join(c.composerPackagesLayer.Root, c.composerBuildpackYAML.Composer.VendorDirectory)
 	composerAppVendorDir := filepath.Join(c.app.Root, c.composerBuildpackYAML.Composer.VendorDirectory)
@@ -105,13 +170,108 @@ func (c Contributor) SetupVendorDir() error {
 		}
 	}
 
+	// in copy mode, materializeVendorDir copies the layer once packages are installed
+	if c.composerBuildpackYAML.Composer.VendorMode == composer.VendorModeCopy {
+		return nil
+	}
+
 	// symlink vendor_home to "vendor" under the app root so PHP apps can find Composer dependencies
 	return helper.WriteSymlink(composerLayerVendorDir, composerAppVendorDir)
 }
 
+// materializeVendorDir copies the packages layer to a real vendor directory under the app root in copy mode, for
+// frameworks and tools that break on a symlinked vendor directory
+func (c Contributor) materializeVendorDir() error {
+	if c.composerBuildpackYAML.Composer.VendorMode != composer.VendorModeCopy {
+		return nil
+	}
+
+	composerLayerVendorDir := filepath.Join(c.composerPackagesLayer.Root, c.composerBuildpackYAML.Composer.VendorDirectory)
+	composerAppVendorDir := filepath.Join(c.app.Root, c.composerBuildpackYAML.Composer.VendorDirectory)
+
+	if err := os.RemoveAll(composerAppVendorDir); err != nil {
+		return err
+	}
+
+	c.composer.Logger.Body("Copying packages to %s", composerAppVendorDir)
+	if err := helper.CopyDirectory(composerLayerVendorDir, composerAppVendorDir); err != nil {
+		return err
+	}
+
+	return normalizeTimestamps(composerAppVendorDir)
+}
+
+// packagesLayerContentNeeded reports whether the build reads the packages layer after contributing it, even when the
+// layer is reused
+func (c Contributor) packagesLayerContentNeeded() bool {
+	cfg := c.composerBuildpackYAML.Composer
+	return cfg.VendorMode == composer.VendorModeCopy || cfg.Preload.Enabled || len(cfg.PostInstall) > 0
+}
+
+// packagesLayerFlags returns the flags of the packages layer. It is only cached in copy mode, since the app carries
+// the packages to launch, or when preload or post_install hooks read it, since a reused launch layer is not restored.
+func (c Contributor) packagesLayerFlags() ([]layers.Flag, error) {
+	cfg := c.composerBuildpackYAML.Composer
+
+	switch cfg.VendorMode {
+	case composer.VendorModeSymlink:
+		if c.packagesLayerContentNeeded() {
+			return []layers.Flag{layers.Launch, layers.Cache}, nil
+		}
+		return []layers.Flag{layers.Launch}, nil
+	case composer.VendorModeCopy:
+		if cfg.Dev {
+			return nil, fmt.Errorf("vendor_mode copy cannot be combined with dev, which needs the packages layer at launch")
+		}
+		return []layers.Flag{layers.Cache}, nil
+	default:
+		return nil, fmt.Errorf("invalid vendor_mode %q, use %q or %q", cfg.VendorMode, composer.VendorModeSymlink, composer.VendorModeCopy)
+	}
+}
+
 func (c Contributor) Contribute() error {
 	randomHash := generateRandomHash()
-	if err := c.cacheLayer.Contribute(Metadata{"PHP Composer Cache", hex.EncodeToString(randomHash[:])}, func(layer layers.Layer) error { return nil }, layers.Cache); err != nil {
+	if err := c.cacheLayer.Contribute(Metadata{Name: "PHP Composer Cache", Hash: hex.EncodeToString(randomHash[:])}, func(layer layers.Layer) error { return nil }, layers.Cache); err != nil {
+		return err
+	}
+
+	// COMPOSER_HOME holds credentials, so it lives outside of any layer and only exists while packages are installed
+	composerHome, err := ioutil.TempDir("", "composer-home")
+	if err != nil {
+		return err
+	}
+	c.composerHome = composerHome
+
+	// credentials must never outlive the build, even when installing packages fails
+	contributeErr := c.contributeWithComposerHome()
+	if err := os.RemoveAll(c.composerHome); err != nil {
+		return err
+	}
+
+	return contributeErr
+}
+
+func (c Contributor) contributeWithComposerHome() error {
+	// override anything possibly set by the user
+	if err := os.Setenv("COMPOSER_HOME", c.composerHome); err != nil {
+		return err
+	}
+
+	if err := c.configureComposerAuth(); err != nil {
+		return err
+	}
+
+	return c.contributePackagesLayer()
+}
+
+func (c Contributor) contributePackagesLayer() error {
+	flags, err := c.packagesLayerFlags()
+	if err != nil {
+		return err
+	}
+
+	// runs before installGlobalPackages installs to the layer and SetupVendorDir adds a vendored vendor directory to it
+	if err := c.repairPackagesLayer(); err != nil {
 		return err
 	}
 
@@ -123,7 +283,42 @@ func (c Contributor) Contribute() error {
 		return err
 	}
 
-	return c.composerPackagesLayer.Contribute(c.composerMetadata, c.contributeComposerPackages, layers.Launch)
+	// the advisory database may change without composer.lock changing, so packages are audited on every build
+	if err := c.auditPackages(); err != nil {
+		return err
+	}
+
+	if err := c.checkAbandoned(); err != nil {
+		return err
+	}
+
+	// the license policy may change without composer.lock changing, so it is checked even when the layer is reused
+	if err := c.checkLicenses(); err != nil {
+		return err
+	}
+
+	if err := c.composerPackagesLayer.Contribute(c.composerMetadata, c.contributeComposerPackages, flags...); err != nil {
+		return err
+	}
+
+	if err := c.materializeVendorDir(); err != nil {
+		return err
+	}
+
+	if err := c.contributeDevTools(); err != nil {
+		return err
+	}
+
+	if err := c.contributeSBOM(); err != nil {
+		return err
+	}
+
+	// the preload script and hooks write to the app directory, so they run even when the packages layer is reused
+	if err := c.writePreload(); err != nil {
+		return err
+	}
+
+	return c.runPostInstallHooks()
 }
 
 func (c Contributor) configureGithubOauthToken() error {
@@ -157,6 +352,86 @@ func (c Contributor) configureGithubOauthToken() error {
 	return nil
 }
 
+// configureComposerAuth writes credentials from `composer` service bindings to auth.json for this build only
+func (c Contributor) configureComposerAuth() error {
+	auth, err := NewComposerAuth(c.services)
+	if err != nil {
+		return err
+	}
+
+	if len(auth) == 0 {
+		return nil
+	}
+
+	c.composer.Logger.Body("Configuring Composer credentials for %s", strings.Join(auth.Hosts(), ", "))
+	return auth.Write(c.composerHome)
+}
+
+// configureCACertificates points Composer at the CA certificates exported by the composer contributor
+func (c Contributor) configureCACertificates() error {
+	if file := os.Getenv("SSL_CERT_FILE"); file != "" {
+		if err := c.composer.Config("cafile", file, true); err != nil {
+			return err
+		}
+	}
+
+	if dir := os.Getenv("SSL_CERT_DIR"); dir != "" {
+		if err := c.composer.Config("capath", dir, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// configureRepositories applies the packagist mirror and additional repositories to the global Composer config
+func (c Contributor) configureRepositories() error {
+	cfg := c.composerBuildpackYAML.Composer
+
+	if cfg.DisablePackagist && cfg.PackagistMirror != "" {
+		return fmt.Errorf("packagist_mirror cannot be used when disable_packagist is set")
+	}
+
+	if cfg.DisablePackagist {
+		c.composer.Logger.Body("Disabling packagist.org")
+		if err := c.composer.Config(packagistRepositoryKey, "false", true); err != nil {
+			return err
+		}
+	} else if cfg.PackagistMirror != "" {
+		c.composer.Logger.Body("Using packagist mirror %s", cfg.PackagistMirror)
+		mirror, err := json.Marshal(composer.Repository{Type: "composer", URL: cfg.PackagistMirror})
+		if err != nil {
+			return err
+		}
+
+		if err := c.composer.Config(packagistRepositoryKey, string(mirror), true); err != nil {
+			return err
+		}
+	}
+
+	for _, repository := range cfg.Repositories {
+		if repository.Name == "" || repository.URL == "" {
+			return fmt.Errorf("repositories require both a name and a url: %+v", repository)
+		}
+
+		if repository.Type == "" {
+			repository.Type = "composer"
+		}
+
+		value, err := json.Marshal(repository)
+		if err != nil {
+			return err
+		}
+
+		c.composer.Logger.Body("Adding %s repository %s", repository.Type, repository.URL)
+		if err := c.composer.Config(fmt.Sprintf("repositories.%s", repository.Name), string(value), true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (c Contributor) installGlobalPackages() error {
 	if len(c.composerBuildpackYAML.Composer.InstallGlobal) > 0 {
 		binPath := strings.Join([]string{os.Getenv("PATH"), filepath.Join(c.composerPackagesLayer.Root, "global/vendor/bin")}, string(os.PathListSeparator))
@@ -186,10 +461,22 @@ func (c Contributor) alwaysRunComposerInit(layer layers.Layer) error {
 		return err
 	}
 
+	if err := c.configureCACertificates(); err != nil {
+		return err
+	}
+
 	if err := c.configureGithubOauthToken(); err != nil {
 		return err
 	}
 
+	if err := c.configureRepositories(); err != nil {
+		return err
+	}
+
+	if err := c.configurePlugins(); err != nil {
+		return err
+	}
+
 	if err := c.installGlobalPackages(); err != nil {
 		return err
 	}
@@ -207,7 +494,164 @@ func (c Contributor) contributeComposerPackages(layer layers.Layer) error {
 		return err
 	}
 
-	return c.composer.Install(c.composerBuildpackYAML.Composer.InstallOptions...)
+	if err := c.checkAutoloader(); err != nil {
+		return err
+	}
+
+	// dev images run tools such as phpunit from vendor/bin
+	if c.composerBuildpackYAML.Composer.Dev {
+		if err := layer.PrependPathLaunchEnv("PATH", filepath.Join(c.app.Root, c.composerBuildpackYAML.Composer.VendorDirectory, "bin")); err != nil {
+			return err
+		}
+	}
+
+	if vendored, err := c.vendoredPackagesMatch(layer); err != nil {
+		return err
+	} else if vendored {
+		if err := c.verifyVendor(layer, nil); err != nil {
+			return err
+		}
+		return normalizeTimestamps(layer.Root)
+	}
+
+	options, err := c.installOptions()
+	if err != nil {
+		return err
+	}
+
+	if err := c.configureAutoloaderSuffix(); err != nil {
+		return err
+	}
+
+	// the licenses of a supplied composer.lock were checked before installing
+	locked, err := helper.FileExists(filepath.Join(c.composerDir, composer.ComposerLock))
+	if err != nil {
+		return err
+	}
+
+	if err := c.installPackages(options...); err != nil {
+		return err
+	}
+
+	// composer.lock now exists, even if the app did not supply one
+	if !locked {
+		if err := c.checkLicenses(); err != nil {
+			return err
+		}
+	}
+
+	if err := c.dumpAutoload(options); err != nil {
+		return err
+	}
+
+	if err := c.runAllowedScripts(); err != nil {
+		return err
+	}
+
+	if err := c.pruneVendor(filepath.Join(layer.Root, c.composerBuildpackYAML.Composer.VendorDirectory)); err != nil {
+		return err
+	}
+
+	if err := c.verifyVendor(layer, options); err != nil {
+		return err
+	}
+
+	return normalizeTimestamps(layer.Root)
+}
+
+// installOptions adds the flags supported by the installed Composer version to the configured install options
+func (c Contributor) installOptions() ([]string, error) {
+	cfg := c.composerBuildpackYAML.Composer
+	options := append([]string{}, cfg.InstallOptions...)
+
+	if cfg.NoScripts && !containsOption(options, "--no-scripts") {
+		options = append(options, "--no-scripts")
+	}
+
+	if len(cfg.AllowedScripts) > 0 && !containsOption(options, "--no-scripts") {
+		return nil, fmt.Errorf("allowed_scripts requires scripts to be disabled with no_scripts")
+	}
+
+	// with --no-autoloader, the autoloader is generated by dumpAutoload instead
+	if !containsOption(options, noAutoloaderOption) {
+		for _, flag := range autoloaderFlags(cfg.Autoloader, false) {
+			if !containsOption(options, flag) {
+				options = append(options, flag)
+			}
+		}
+	}
+
+	// the audit run by Composer 2.4+ after installing needs network access, and never fails the install
+	if ok, err := c.composer.SupportsAudit(); err != nil {
+		return nil, err
+	} else if ok && !containsOption(options, "--no-audit") {
+		options = append(options, "--no-audit")
+	}
+
+	return options, nil
+}
+
+// runAllowedScripts runs the scripts allowed in buildpack.yml after installing with --no-scripts
+func (c Contributor) runAllowedScripts() error {
+	args := []string{}
+	if !c.installsDev() {
+		args = append(args, "--no-dev")
+	}
+
+	for _, script := range c.composerBuildpackYAML.Composer.AllowedScripts {
+		c.composer.Logger.Body("Running Composer script %s", script)
+
+		start := time.Now()
+		if err := c.composer.RunScript(script, args...); err != nil {
+			return fmt.Errorf("composer script %s failed after %s: %s", script, time.Since(start).Round(time.Millisecond), err)
+		}
+
+		c.composer.Logger.Body("Completed Composer script %s in %s", script, time.Since(start).Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+func containsOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// installPackages runs `composer install`, retrying once with a raised memory limit if Composer runs out of memory
+func (c Contributor) installPackages(options ...string) error {
+	cfg := c.composerBuildpackYAML.Composer
+
+	err := c.composer.Install(options...)
+	if !errors.As(err, &composer.MemoryExhaustedError{}) {
+		return err
+	}
+
+	recommendation := "Set `composer.php_ini.directives.memory_limit` in buildpack.yml to a higher value (e.g. \"2G\" or \"-1\") " +
+		"so that Composer has enough memory to install your packages."
+
+	if !cfg.RetryOnOOM {
+		c.composer.Logger.BodyWarning("Composer ran out of memory. %s", recommendation)
+		return err
+	}
+
+	c.composer.Logger.BodyWarning("Composer ran out of memory, retrying with COMPOSER_MEMORY_LIMIT=%s", cfg.RetryMemoryLimit)
+	if err := os.Setenv("COMPOSER_MEMORY_LIMIT", cfg.RetryMemoryLimit); err != nil {
+		return err
+	}
+
+	if err := c.composer.Install(options...); err != nil {
+		if errors.As(err, &composer.MemoryExhaustedError{}) {
+			c.composer.Logger.BodyWarning("Composer ran out of memory again with COMPOSER_MEMORY_LIMIT=%s. %s", cfg.RetryMemoryLimit, recommendation)
+		}
+		return err
+	}
+
+	c.composer.Logger.BodyWarning("Composer succeeded with COMPOSER_MEMORY_LIMIT=%s. %s", cfg.RetryMemoryLimit, recommendation)
+	return nil
 }
 
 func (c Contributor) enablePHPExtensions(extensions []string) error {
@@ -246,12 +690,7 @@ func (c Contributor) warnAboutPublicComposerFiles(layer layers.Layer) error {
 
 func (c Contributor) initializeEnv(vendorDirectory string) error {
 	// override anything possibly set by the user
-	err := os.Setenv("COMPOSER_HOME", filepath.Join(c.composerLayer.Root, ".composer"))
-	if err != nil {
-		return err
-	}
-
-	err = os.Setenv("COMPOSER_CACHE_DIR", filepath.Join(c.cacheLayer.Root, "cache"))
+	err := os.Setenv("COMPOSER_CACHE_DIR", filepath.Join(c.cacheLayer.Root, "cache"))
 	if err != nil {
 		return err
 	}
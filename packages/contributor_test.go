@@ -2,23 +2,76 @@ package packages
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
 	"math/rand"
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/cloudfoundry/libcfbuildpack/helper"
+	"github.com/cloudfoundry/libcfbuildpack/layers"
 
 	bplogger "github.com/buildpack/libbuildpack/logger"
 	"github.com/cloudfoundry/libcfbuildpack/logger"
+	"github.com/cloudfoundry/libcfbuildpack/services"
 	"github.com/cloudfoundry/libcfbuildpack/test"
 	"github.com/paketo-buildpacks/php-composer/composer"
+	"github.com/paketo-buildpacks/php-composer/runner"
 
 	. "github.com/onsi/gomega"
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 )
 
+// sequenceRunner returns the given errors in order, one per command
+type sequenceRunner struct {
+	*runner.FakeRunner
+	errs []error
+}
+
+func (r *sequenceRunner) Run(bin, dir string, args ...string) error {
+	r.FakeRunner.Err = r.errs[len(r.Calls)]
+	return r.FakeRunner.Run(bin, dir, args...)
+}
+
+// composerHomeRunner simulates `composer config -g github-oauth.github.com <token>` writing to COMPOSER_HOME
+type composerHomeRunner struct {
+	*runner.FakeRunner
+	composerHome string
+}
+
+func (r *composerHomeRunner) Run(bin, dir string, args ...string) error {
+	r.composerHome = os.Getenv("COMPOSER_HOME")
+	if err := helper.WriteFile(filepath.Join(r.composerHome, "config.json"), 0600, `{"config": {"github-oauth": {"github.com": "secret-github-token"}}}`); err != nil {
+		return err
+	}
+	return r.FakeRunner.Run(bin, dir, args...)
+}
+
+// newTestContributor writes buildpack.yml, unless it is empty, and creates a contributor that runs commands with r and
+// logs warnings and body lines to info, unless they are nil
+func newTestContributor(t *testing.T, factory *test.BuildFactory, buildpackYAML string, r runner.Runner, info *bytes.Buffer) Contributor {
+	t.Helper()
+
+	if buildpackYAML != "" {
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), buildpackYAML)
+	}
+
+	contributor, _, err := NewContributor(factory.Build, "/tmp")
+	Expect(err).NotTo(HaveOccurred())
+
+	if r != nil {
+		contributor.composer.Runner = r
+	}
+	if info != nil {
+		contributor.composer.Logger = logger.Logger{Logger: bplogger.NewLogger(&bytes.Buffer{}, info)}
+	}
+
+	return contributor
+}
+
 func TestUnitComposerPackage(t *testing.T) {
 	spec.Run(t, "ComposerPackage", testComposerPackage, spec.Report(report.Terminal{}))
 }
@@ -50,6 +103,31 @@ func testComposerPackage(t *testing.T, when spec.G, it spec.S) {
 				Expect(contributor.composerMetadata.Name).To(Equal("PHP Composer"))
 				Expect(contributor.composerMetadata.Hash).To(Equal("fe2ebd62604e50ad1682fb67979fd368375c2347973c47af8b0394a5359e3e08"))
 			})
+
+			it("uses a separate cache key in dev mode", func() {
+				test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `this is a lock file`)
+				test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"dev": true}}`)
+
+				contributor, _, err := NewContributor(factory.Build, "/tmp")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(contributor.composerMetadata.Name).To(Equal("PHP Composer (dev)"))
+				Expect(contributor.composerMetadata.Hash).To(Equal("fe2ebd62604e50ad1682fb67979fd368375c2347973c47af8b0394a5359e3e08"))
+			})
+
+			it("includes the settings that change installed packages in the composer metadata", func() {
+				test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `this is a lock file`)
+
+				settings := func(buildpackYAML string) string {
+					return newTestContributor(t, factory, buildpackYAML, nil, nil).composerMetadata.Settings
+				}
+
+				defaults := settings(`{"composer": {}}`)
+				Expect(settings(`{"composer": {"preload": {"enabled": true}}}`)).To(Equal(defaults))
+				Expect(settings(`{"composer": {"autoloader": {"apcu": true}}}`)).NotTo(Equal(defaults))
+				Expect(settings(`{"composer": {"prune": {"enabled": true}}}`)).NotTo(Equal(defaults))
+				Expect(settings(`{"composer": {"no_scripts": true}}`)).NotTo(Equal(defaults))
+				Expect(settings(`{"composer": {"no_scripts": true, "allowed_scripts": ["post-install-cmd"]}}`)).NotTo(Equal(settings(`{"composer": {"no_scripts": true}}`)))
+			})
 		})
 
 		when("there isn't a lock file", func() {
@@ -120,6 +198,480 @@ func testComposerPackage(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("configuring repositories", func() {
+		var fakeRunner *runner.FakeRunner
+
+		it.Before(func() {
+			Expect(helper.WriteFile(filepath.Join(factory.Build.Application.Root, "composer.json"), 0644, "")).ToNot(HaveOccurred())
+			fakeRunner = &runner.FakeRunner{}
+		})
+
+		it("configures a packagist mirror and additional repositories globally", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"packagist_mirror": "https://mirror.example.com", "repositories": [{"name": "internal", "url": "https://satis.example.com"}]}}`)
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = fakeRunner
+
+			Expect(contributor.configureRepositories()).To(Succeed())
+			pharPath := filepath.Join("/tmp", composer.ComposerPHAR)
+			Expect(fakeRunner.Calls).To(Equal([][]string{
+				{"php", pharPath, "config", "-g", "repositories.packagist.org", `{"type":"composer","url":"https://mirror.example.com"}`},
+				{"php", pharPath, "config", "-g", "repositories.internal", `{"type":"composer","url":"https://satis.example.com"}`},
+			}))
+		})
+
+		it("disables packagist.org", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"disable_packagist": true}}`)
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = fakeRunner
+
+			Expect(contributor.configureRepositories()).To(Succeed())
+			Expect(fakeRunner.Arguments).To(Equal([]string{"php", filepath.Join("/tmp", composer.ComposerPHAR), "config", "-g", "repositories.packagist.org", "false"}))
+		})
+
+		it("rejects a mirror when packagist.org is disabled", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"disable_packagist": true, "packagist_mirror": "https://mirror.example.com"}}`)
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = fakeRunner
+
+			Expect(contributor.configureRepositories()).To(MatchError(ContainSubstring("packagist_mirror cannot be used")))
+			Expect(fakeRunner.Calls).To(BeEmpty())
+		})
+
+		it("rejects repositories without a url", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"repositories": [{"name": "internal"}]}}`)
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = fakeRunner
+
+			Expect(contributor.configureRepositories()).To(MatchError(ContainSubstring("repositories require both a name and a url")))
+		})
+	})
+
+	when("CA certificates are configured", func() {
+		it("points Composer at them", func() {
+			Expect(helper.WriteFile(filepath.Join(factory.Build.Application.Root, "composer.json"), 0644, "")).ToNot(HaveOccurred())
+			Expect(os.Setenv("SSL_CERT_FILE", "/certs/bundle.pem")).To(Succeed())
+			defer os.Unsetenv("SSL_CERT_FILE")
+			Expect(os.Setenv("SSL_CERT_DIR", "/certs")).To(Succeed())
+			defer os.Unsetenv("SSL_CERT_DIR")
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			fakeRunner := &runner.FakeRunner{}
+			contributor.composer.Runner = fakeRunner
+
+			Expect(contributor.configureCACertificates()).To(Succeed())
+			pharPath := filepath.Join("/tmp", composer.ComposerPHAR)
+			Expect(fakeRunner.Calls).To(Equal([][]string{
+				{"php", pharPath, "config", "-g", "cafile", "/certs/bundle.pem"},
+				{"php", pharPath, "config", "-g", "capath", "/certs"},
+			}))
+		})
+	})
+
+	when("choosing install options", func() {
+		var fakeRunner *runner.FakeRunner
+
+		it.Before(func() {
+			Expect(helper.WriteFile(filepath.Join(factory.Build.Application.Root, "composer.json"), 0644, "")).ToNot(HaveOccurred())
+			fakeRunner = &runner.FakeRunner{}
+		})
+
+		it("disables the post-install audit of Composer 2.4+", func() {
+			fakeRunner.Out = bytes.NewBufferString("Composer version 2.4.0 2022-08-16 16:10:48")
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = fakeRunner
+
+			Expect(contributor.installOptions()).To(Equal([]string{"--no-dev", "--no-audit"}))
+		})
+
+		it("disables scripts", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"no_scripts": true}}`)
+			fakeRunner.Out = bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20")
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = fakeRunner
+
+			Expect(contributor.installOptions()).To(Equal([]string{"--no-dev", "--no-scripts"}))
+		})
+
+		it("rejects allowed scripts when scripts are not disabled", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"allowed_scripts": ["post-install-cmd"]}}`)
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = fakeRunner
+
+			_, err = contributor.installOptions()
+			Expect(err).To(MatchError("allowed_scripts requires scripts to be disabled with no_scripts"))
+		})
+
+		it("uses the configured options with older Composer versions", func() {
+			fakeRunner.Out = bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20")
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = fakeRunner
+
+			Expect(contributor.installOptions()).To(Equal([]string{"--no-dev"}))
+		})
+	})
+
+	when("running allowed scripts", func() {
+		it.Before(func() {
+			Expect(helper.WriteFile(filepath.Join(factory.Build.Application.Root, "composer.json"), 0644, "")).ToNot(HaveOccurred())
+		})
+
+		it("runs each script after install", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"no_scripts": true, "allowed_scripts": ["post-autoload-dump", "assets"]}}`)
+			fakeRunner := &runner.FakeRunner{}
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = fakeRunner
+
+			Expect(contributor.runAllowedScripts()).To(Succeed())
+			pharPath := filepath.Join("/tmp", composer.ComposerPHAR)
+			Expect(fakeRunner.Calls).To(Equal([][]string{
+				{"php", pharPath, "run-script", "post-autoload-dump", "--no-dev"},
+				{"php", pharPath, "run-script", "assets", "--no-dev"},
+			}))
+		})
+
+		it("stops at the first failing script", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"no_scripts": true, "allowed_scripts": ["cache-clear", "assets"]}}`)
+			fakeRunner := &runner.FakeRunner{Err: errors.New("exit status 1")}
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = fakeRunner
+
+			Expect(contributor.runAllowedScripts()).To(MatchError(MatchRegexp(`composer script cache-clear failed after .+: exit status 1`)))
+			Expect(fakeRunner.Calls).To(HaveLen(1))
+		})
+	})
+
+	when("dev mode is enabled", func() {
+		it("installs require-dev and puts vendor/bin on the launch PATH", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"dev": true}}`)
+			fakeRunner := &runner.FakeRunner{Out: bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20")}
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = fakeRunner
+
+			// simulates the vendor directory written by `composer install`
+			layer := factory.Build.Layers.Layer(composer.PackagesDependency)
+			test.WriteFile(t, filepath.Join(layer.Root, "vendor", "autoload.php"), "<?php")
+			test.WriteFile(t, filepath.Join(layer.Root, "vendor", "composer", "installed.json"), `{"packages": []}`)
+
+			Expect(contributor.contributeComposerPackages(layer)).To(Succeed())
+			Expect(fakeRunner.Arguments).To(Equal([]string{"php", filepath.Join("/tmp", composer.ComposerPHAR), "install", "--no-progress"}))
+			Expect(filepath.Join(layer.Root, "env.launch", "PATH")).To(test.HaveContent(filepath.Join(factory.Build.Application.Root, "vendor", "bin")))
+		})
+	})
+
+	when("composer install runs out of memory", func() {
+		var sequence *sequenceRunner
+
+		it.Before(func() {
+			Expect(helper.WriteFile(filepath.Join(factory.Build.Application.Root, "composer.json"), 0644, "")).ToNot(HaveOccurred())
+			sequence = &sequenceRunner{FakeRunner: &runner.FakeRunner{}}
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("COMPOSER_MEMORY_LIMIT")).To(Succeed())
+		})
+
+		it("retries once with a raised memory limit", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"retry_memory_limit": "3G"}}`)
+			sequence.errs = []error{composer.MemoryExhaustedError{Err: errors.New("exit status 255")}, nil}
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = sequence
+
+			Expect(contributor.installPackages("--no-dev")).To(Succeed())
+			Expect(sequence.Calls).To(HaveLen(2))
+			Expect(os.Getenv("COMPOSER_MEMORY_LIMIT")).To(Equal("3G"))
+		})
+
+		it("fails without retrying when retries are disabled", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"retry_on_oom": false}}`)
+			sequence.errs = []error{composer.MemoryExhaustedError{Err: errors.New("exit status 255")}, nil}
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = sequence
+
+			Expect(contributor.installPackages("--no-dev")).To(MatchError(ContainSubstring("composer ran out of memory")))
+			Expect(sequence.Calls).To(HaveLen(1))
+			Expect(os.Getenv("COMPOSER_MEMORY_LIMIT")).To(BeEmpty())
+		})
+
+		it("does not retry other failures", func() {
+			sequence.errs = []error{errors.New("exit status 2"), nil}
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = sequence
+
+			Expect(contributor.installPackages("--no-dev")).To(MatchError("exit status 2"))
+			Expect(sequence.Calls).To(HaveLen(1))
+		})
+	})
+
+	when("credentials are configured", func() {
+		it("leaves no credentials in COMPOSER_HOME or any layer", func() {
+			Expect(helper.WriteFile(filepath.Join(factory.Build.Application.Root, "composer.json"), 0644, "")).ToNot(HaveOccurred())
+			factory.AddService("composer", services.Credentials{"bearer": map[string]interface{}{"repo.example.com": "secret-bearer-token"}})
+
+			contributor, willContribute, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(willContribute).To(BeTrue())
+			homeRunner := &composerHomeRunner{FakeRunner: &runner.FakeRunner{Out: bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20")}}
+			contributor.composer.Runner = homeRunner
+			Expect(contributor.composerHome).To(BeEmpty())
+
+			// simulates the vendor directory written by `composer install`
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "vendor", "autoload.php"), "<?php")
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "vendor", "composer", "installed.json"), `{"packages": []}`)
+
+			Expect(contributor.Contribute()).To(Succeed())
+			Expect(homeRunner.composerHome).NotTo(BeEmpty())
+			Expect(homeRunner.composerHome).NotTo(HavePrefix(factory.Build.Layers.Root))
+			Expect(homeRunner.composerHome).NotTo(BeAnExistingFile())
+
+			err = filepath.Walk(factory.Build.Layers.Root, func(path string, info os.FileInfo, err error) error {
+				if err != nil || !info.Mode().IsRegular() {
+					return err
+				}
+
+				contents, err := ioutil.ReadFile(path)
+				if err != nil {
+					return err
+				}
+
+				Expect(string(contents)).NotTo(ContainSubstring("secret-bearer-token"), path)
+				Expect(string(contents)).NotTo(ContainSubstring("secret-github-token"), path)
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	when("the packages layer is reused without its content", func() {
+		var installer *installRunner
+
+		it.Before(func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{"packages": []}`)
+			installer = &installRunner{
+				FakeRunner: &runner.FakeRunner{Out: bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20")},
+				now:        time.Now(),
+			}
+		})
+
+		it("caches the layer and rebuilds it for post_install hooks", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"post_install": [{"command": "php artisan optimize"}]}}`, installer, nil)
+			Expect(contributor.packagesLayerFlags()).To(Equal([]layers.Flag{layers.Launch, layers.Cache}))
+
+			// a launch layer from the previous build, of which the platform only restored the metadata
+			layer := contributor.composerPackagesLayer
+			Expect(layer.WriteMetadata(contributor.composerMetadata, layers.Launch)).To(Succeed())
+
+			Expect(contributor.contributePackagesLayer()).To(Succeed())
+			Expect(installer.Calls).To(ContainElement(ContainElement("install")))
+			Expect(installer.Arguments).To(Equal([]string{"sh", "-c", "php artisan optimize"}))
+			Expect(filepath.Join(layer.Root, "vendor", "autoload.php")).To(BeARegularFile())
+			Expect(layer).To(test.HaveLayerMetadata(false, true, true))
+		})
+
+		it("keeps the global packages when rebuilding the layer", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"install_global": ["friendsofphp/php-cs-fixer"], "post_install": [{"command": "php-cs-fixer fix"}]}}`, installer, nil)
+
+			layer := contributor.composerPackagesLayer
+			Expect(layer.WriteMetadata(contributor.composerMetadata, layers.Launch)).To(Succeed())
+
+			Expect(contributor.contributePackagesLayer()).To(Succeed())
+			Expect(installer.Calls).To(ContainElement(ContainElement("install")))
+			Expect(filepath.Join(layer.Root, "global", "vendor", "bin", "php-cs-fixer")).To(BeARegularFile())
+		})
+
+		it("caches the layer for preload", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"preload": {"enabled": true}}}`, installer, nil)
+			Expect(contributor.packagesLayerFlags()).To(Equal([]layers.Flag{layers.Launch, layers.Cache}))
+		})
+
+		it("reuses the layer when nothing reads it", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {}}`, installer, nil)
+			Expect(contributor.packagesLayerFlags()).To(Equal([]layers.Flag{layers.Launch}))
+
+			layer := contributor.composerPackagesLayer
+			Expect(layer.WriteMetadata(contributor.composerMetadata, layers.Launch)).To(Succeed())
+
+			Expect(contributor.contributePackagesLayer()).To(Succeed())
+			Expect(installer.Calls).NotTo(ContainElement(ContainElement("install")))
+		})
+	})
+
+	when("vendor_mode is copy", func() {
+		it.Before(func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+		})
+
+		it("caches the packages layer and copies it to a real vendor directory", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"vendor_mode": "copy"}}`)
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "vendor", "vendored_file.txt"), "stuff")
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(contributor.packagesLayerFlags()).To(Equal([]layers.Flag{layers.Cache}))
+
+			appVendorDir := filepath.Join(factory.Build.Application.Root, "vendor")
+			Expect(contributor.SetupVendorDir()).To(Succeed())
+			Expect(appVendorDir).NotTo(BeAnExistingFile())
+
+			test.WriteFile(t, filepath.Join(contributor.composerPackagesLayer.Root, "vendor", "autoload.php"), "<?php")
+			Expect(contributor.materializeVendorDir()).To(Succeed())
+
+			info, err := os.Lstat(appVendorDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.IsDir()).To(BeTrue())
+			Expect(filepath.Join(appVendorDir, "vendored_file.txt")).To(test.HaveContent("stuff"))
+			Expect(filepath.Join(appVendorDir, "autoload.php")).To(BeARegularFile())
+		})
+
+		it("rebuilds the packages layer after switching from symlink mode", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{"packages": []}`)
+			installer := &installRunner{
+				FakeRunner: &runner.FakeRunner{Out: bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20")},
+				now:        time.Now(),
+			}
+
+			// a launch-only layer from a symlink mode build, of which the platform only restored the metadata
+			symlinked := newTestContributor(t, factory, `{"composer": {}}`, installer, nil)
+			Expect(symlinked.composerPackagesLayer.WriteMetadata(symlinked.composerMetadata, layers.Launch)).To(Succeed())
+
+			contributor := newTestContributor(t, factory, `{"composer": {"vendor_mode": "copy"}}`, installer, nil)
+			Expect(contributor.composerMetadata.Name).To(Equal("PHP Composer (copy)"))
+			Expect(contributor.composerMetadata.Hash).To(Equal(symlinked.composerMetadata.Hash))
+
+			Expect(contributor.contributePackagesLayer()).To(Succeed())
+			Expect(installer.Calls).To(ContainElement(ContainElement("install")))
+			Expect(filepath.Join(factory.Build.Application.Root, "vendor", "autoload.php")).To(BeARegularFile())
+			Expect(contributor.composerPackagesLayer).To(test.HaveLayerMetadata(false, true, false))
+		})
+
+		it("reinstalls the packages of a restored layer when the settings change", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{"packages": []}`)
+			installer := &installRunner{
+				FakeRunner: &runner.FakeRunner{Out: bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20")},
+				now:        time.Now(),
+			}
+
+			// a cached layer from the previous build, restored with its packages
+			previous := newTestContributor(t, factory, `{"composer": {"vendor_mode": "copy"}}`, installer, nil)
+			layer := previous.composerPackagesLayer
+			Expect(layer.WriteMetadata(previous.composerMetadata, layers.Cache)).To(Succeed())
+			test.WriteFile(t, filepath.Join(layer.Root, "vendor", "autoload.php"), "<?php")
+			test.WriteFile(t, filepath.Join(layer.Root, "vendor", "composer", "installed.json"), `{"packages": []}`)
+
+			contributor := newTestContributor(t, factory, `{"composer": {"vendor_mode": "copy", "autoloader": {"optimize": true}}}`, installer, nil)
+
+			Expect(contributor.contributePackagesLayer()).To(Succeed())
+			Expect(installer.Calls).To(ContainElement(ContainElement("install")))
+			Expect(installer.Calls).To(ContainElement(ContainElement("--optimize-autoloader")))
+		})
+
+		it("rebuilds a reused packages layer that was not restored", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{"packages": []}`)
+			installer := &installRunner{
+				FakeRunner: &runner.FakeRunner{Out: bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20")},
+				now:        time.Now(),
+			}
+
+			contributor := newTestContributor(t, factory, `{"composer": {"vendor_mode": "copy"}}`, installer, nil)
+			Expect(contributor.composerPackagesLayer.WriteMetadata(contributor.composerMetadata, layers.Cache)).To(Succeed())
+
+			Expect(contributor.contributePackagesLayer()).To(Succeed())
+			Expect(installer.Calls).To(ContainElement(ContainElement("install")))
+			Expect(filepath.Join(factory.Build.Application.Root, "vendor", "autoload.php")).To(BeARegularFile())
+		})
+
+		it("rejects dev mode", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"vendor_mode": "copy", "dev": true}}`)
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = contributor.packagesLayerFlags()
+			Expect(err).To(MatchError(ContainSubstring("vendor_mode copy cannot be combined with dev")))
+		})
+
+		it("rejects unknown modes", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"vendor_mode": "hardlink"}}`)
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = contributor.packagesLayerFlags()
+			Expect(err).To(MatchError(`invalid vendor_mode "hardlink", use "symlink" or "copy"`))
+		})
+	})
+
+	when("verifying installed packages", func() {
+		var (
+			contributor Contributor
+			vendorDir   string
+		)
+
+		it.Before(func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{
+				"packages": [{"name": "monolog/monolog", "version": "2.3.5"}],
+				"packages-dev": [{"name": "phpunit/phpunit", "version": "9.5.10"}]
+			}`)
+
+			var err error
+			contributor, _, err = NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			vendorDir = filepath.Join(contributor.composerPackagesLayer.Root, "vendor")
+		})
+
+		it("accepts an autoloader and the locked packages in the Composer 1 format", func() {
+			test.WriteFile(t, filepath.Join(vendorDir, "autoload.php"), "<?php")
+			test.WriteFile(t, filepath.Join(vendorDir, "composer", "installed.json"), `[{"name": "monolog/monolog", "version": "2.3.5"}]`)
+
+			Expect(contributor.verifyVendor(contributor.composerPackagesLayer, []string{"--no-dev"})).To(Succeed())
+		})
+
+		it("rejects a missing autoloader and mismatched packages", func() {
+			test.WriteFile(t, filepath.Join(vendorDir, "composer", "installed.json"), `{"packages": [{"name": "monolog/monolog", "version": "2.3.4"}]}`)
+
+			Expect(contributor.verifyVendor(contributor.composerPackagesLayer, []string{"--no-dev"})).To(MatchError(`installed packages do not match composer.lock:
+  vendor/autoload.php is missing
+  monolog/monolog 2.3.4 is installed instead of 2.3.5`))
+		})
+
+		it("rejects a missing installed.json", func() {
+			Expect(contributor.verifyVendor(contributor.composerPackagesLayer, []string{"--no-autoloader"})).To(MatchError(`installed packages do not match composer.lock:
+  vendor/composer/installed.json is missing`))
+		})
+	})
+
 	when("The vendor folder already exists", func() {
 		it("moves it to a layer & links it ", func() {
 			Expect(helper.WriteFile(filepath.Join(factory.Build.Application.Root, "composer.json"), 0644, "")).ToNot(HaveOccurred())
@@ -137,5 +689,50 @@ func testComposerPackage(t *testing.T, when spec.G, it spec.S) {
 			Expect(vendorDirPath).To(BeADirectory())
 		})
 
+		when("it was installed from composer.lock", func() {
+			var fakeRunner *runner.FakeRunner
+
+			it.Before(func() {
+				test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+				test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{
+					"packages": [{"name": "monolog/monolog", "version": "2.3.5"}],
+					"packages-dev": [{"name": "phpunit/phpunit", "version": "9.5.10"}]
+				}`)
+				fakeRunner = &runner.FakeRunner{Out: bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20")}
+			})
+
+			it("skips composer install when the packages match", func() {
+				test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "vendor", "autoload.php"), "<?php")
+				test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "vendor", "composer", "installed.json"),
+					`{"packages": [{"name": "monolog/monolog", "version": "2.3.5"}], "dev": false, "dev-package-names": []}`)
+
+				contributor, _, err := NewContributor(factory.Build, "/tmp")
+				Expect(err).NotTo(HaveOccurred())
+				contributor.composer.Runner = fakeRunner
+
+				Expect(contributor.SetupVendorDir()).To(Succeed())
+				Expect(contributor.contributeComposerPackages(contributor.composerPackagesLayer)).To(Succeed())
+				Expect(fakeRunner.Calls).To(BeEmpty())
+			})
+
+			it("installs and logs the differences when the packages do not match", func() {
+				test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "vendor", "composer", "installed.json"),
+					`[{"name": "monolog/monolog", "version": "2.3.4"}, {"name": "psr/log", "version": "1.1.4"}]`)
+				info := &bytes.Buffer{}
+
+				contributor, _, err := NewContributor(factory.Build, "/tmp")
+				Expect(err).NotTo(HaveOccurred())
+				contributor.composer.Runner = fakeRunner
+				contributor.composer.Logger = logger.Logger{Logger: bplogger.NewLogger(&bytes.Buffer{}, info)}
+
+				Expect(contributor.SetupVendorDir()).To(Succeed())
+
+				// the fake install leaves the vendored packages as they are, which verification then rejects
+				Expect(contributor.contributeComposerPackages(contributor.composerPackagesLayer)).To(MatchError(ContainSubstring("installed packages do not match composer.lock")))
+				Expect(fakeRunner.Arguments).To(ContainElement("install"))
+				Expect(info.String()).To(ContainSubstring("monolog/monolog 2.3.4 is installed instead of 2.3.5"))
+				Expect(info.String()).To(ContainSubstring("psr/log 1.1.4 is not in composer.lock"))
+			})
+		})
 	})
 }
@@ -0,0 +1,69 @@
+package packages
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libcfbuildpack/layers"
+)
+
+// contributeDevTools installs the full require-dev set to a build-only layer, so post-install hooks can use dev
+// packages that the launch layer, installed with --no-dev, never ships
+func (c Contributor) contributeDevTools() error {
+	cfg := c.composerBuildpackYAML.Composer
+	if !cfg.DevTools {
+		return nil
+	}
+
+	if cfg.Dev {
+		return fmt.Errorf("dev_tools cannot be combined with dev, which already installs require-dev at launch")
+	}
+
+	if c.installsDev() {
+		return fmt.Errorf("dev_tools requires --no-dev in install_options, so that require-dev is not installed at launch")
+	}
+
+	metadata := Metadata{Name: "PHP Composer Dev Tools", Hash: c.composerMetadata.Hash, Settings: c.composerMetadata.Settings}
+	if err := c.devToolsLayer.Contribute(metadata, func(layer layers.Layer) (err error) {
+		options, err := c.installOptions()
+		if err != nil {
+			return err
+		}
+
+		devOptions := []string{}
+		for _, option := range options {
+			if option != "--no-dev" {
+				devOptions = append(devOptions, option)
+			}
+		}
+
+		// scripts already ran for the launch install, and would run against the wrong vendor directory here
+		if !containsOption(devOptions, "--no-scripts") {
+			devOptions = append(devOptions, "--no-scripts")
+		}
+
+		if err := os.Setenv("COMPOSER_VENDOR_DIR", filepath.Join(layer.Root, "vendor")); err != nil {
+			return err
+		}
+		// the hooks that follow run Composer against the app's vendor directory, even when this install fails
+		defer func() {
+			if restoreErr := c.setAppVendorDir(); err == nil {
+				err = restoreErr
+			}
+		}()
+
+		if err := c.installPackages(devOptions...); err != nil {
+			return err
+		}
+
+		return layer.PrependPathBuildEnv("PATH", filepath.Join(layer.Root, "vendor", "bin"))
+	}, layers.Build, layers.Cache); err != nil {
+		return err
+	}
+
+	// dev tools come after the app's vendor/bin, so hooks run the launch version of packages in both sets
+	binPath := strings.Join([]string{os.Getenv("PATH"), filepath.Join(c.devToolsLayer.Root, "vendor", "bin")}, string(os.PathListSeparator))
+	return os.Setenv("PATH", binPath)
+}
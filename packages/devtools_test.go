@@ -0,0 +1,93 @@
+package packages
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+	"github.com/paketo-buildpacks/php-composer/runner"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+// failingInstallRunner fails `composer install` after the dev tools layer set COMPOSER_VENDOR_DIR
+type failingInstallRunner struct {
+	*runner.FakeRunner
+}
+
+func (r failingInstallRunner) Run(bin, dir string, args ...string) error {
+	if err := r.FakeRunner.Run(bin, dir, args...); err != nil || len(args) < 2 || args[1] != "install" {
+		return err
+	}
+	return errors.New("install failed")
+}
+
+func TestUnitDevTools(t *testing.T) {
+	spec.Run(t, "DevTools", testDevTools, spec.Report(report.Terminal{}))
+}
+
+func testDevTools(t *testing.T, when spec.G, it spec.S) {
+	var (
+		factory    *test.BuildFactory
+		fakeRunner *runner.FakeRunner
+		path       string
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		factory = test.NewBuildFactory(t)
+		fakeRunner = &runner.FakeRunner{Out: bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20")}
+		path = os.Getenv("PATH")
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+	})
+
+	it.After(func() {
+		Expect(os.Setenv("PATH", path)).To(Succeed())
+	})
+
+	it("installs require-dev to a build-only layer", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"dev_tools": true, "install_options": ["--no-dev", "--prefer-dist"]}}`, fakeRunner, nil)
+
+		Expect(contributor.contributeDevTools()).To(Succeed())
+
+		layer := factory.Build.Layers.Layer(composer.DevToolsDependency)
+		Expect(layer).To(test.HaveLayerMetadata(true, true, false))
+		Expect(fakeRunner.Arguments).To(Equal([]string{"php", filepath.Join("/tmp", composer.ComposerPHAR), "install", "--no-progress", "--prefer-dist", "--no-scripts"}))
+		Expect(filepath.Join(layer.Root, "env.build", "PATH")).To(test.HaveContent(filepath.Join(layer.Root, "vendor", "bin")))
+		Expect(os.Getenv("PATH")).To(HaveSuffix(string(os.PathListSeparator) + filepath.Join(layer.Root, "vendor", "bin")))
+		Expect(os.Getenv("COMPOSER_VENDOR_DIR")).To(Equal(filepath.Join(factory.Build.Layers.Layer(composer.PackagesDependency).Root, "vendor")))
+	})
+
+	it("restores the app's vendor directory when the install fails", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"dev_tools": true}}`, failingInstallRunner{fakeRunner}, nil)
+		Expect(contributor.setAppVendorDir()).To(Succeed())
+
+		Expect(contributor.contributeDevTools()).To(MatchError(ContainSubstring("install failed")))
+		Expect(os.Getenv("COMPOSER_VENDOR_DIR")).To(Equal(filepath.Join(factory.Build.Layers.Layer(composer.PackagesDependency).Root, "vendor")))
+	})
+
+	it("rejects dev_tools in dev mode", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"dev_tools": true, "dev": true}}`, fakeRunner, nil)
+
+		Expect(contributor.contributeDevTools()).To(MatchError(ContainSubstring("dev_tools cannot be combined with dev")))
+	})
+
+	it("requires --no-dev for the launch install", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"dev_tools": true, "install_options": []}}`, fakeRunner, nil)
+
+		Expect(contributor.contributeDevTools()).To(MatchError(ContainSubstring("dev_tools requires --no-dev in install_options")))
+	})
+
+	it("does nothing unless enabled", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {}}`, fakeRunner, nil)
+
+		Expect(contributor.contributeDevTools()).To(Succeed())
+		Expect(fakeRunner.Calls).To(BeEmpty())
+	})
+}
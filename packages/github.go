@@ -1,10 +1,13 @@
 package packages
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"time"
 )
 
@@ -42,7 +45,16 @@ func (g *Github) makeRequest(url string) error {
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("token %s", g.Token))
-	t := &http.Transport{Proxy: http.ProxyFromEnvironment}
+
+	rootCAs, err := caCertPool()
+	if err != nil {
+		return err
+	}
+
+	t := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{RootCAs: rootCAs},
+	}
 
 	client := http.Client{Transport: t, Timeout: time.Second * githubTimeout}
 	resp, err := client.Do(req)
@@ -59,6 +71,27 @@ func (g *Github) makeRequest(url string) error {
 	return nil
 }
 
+// caCertPool trusts the system certificates plus SSL_CERT_FILE, matching what Composer and PHP are configured with
+func caCertPool() (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if file := os.Getenv("SSL_CERT_FILE"); file != "" {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if !pool.AppendCertsFromPEM(buf) {
+			return nil, fmt.Errorf("no certificates found in SSL_CERT_FILE %s", file)
+		}
+	}
+
+	return pool, nil
+}
+
 func (g *Github) checkRateLimit() (bool, error) {
 	type GithubRateLimitResponse struct {
 		Resources struct {
@@ -1,9 +1,13 @@
 package packages
 
 import (
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -20,6 +24,28 @@ func testGithub(t *testing.T, when spec.G, it spec.S) {
 		RegisterTestingT(t)
 	})
 
+	when("the GitHub API is behind a custom CA", func() {
+		it("trusts the certificates in SSL_CERT_FILE", func() {
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintln(w, `{"resources": {"core": {"remaining": 1}}}`)
+			}))
+			defer ts.Close()
+
+			_, err := NewGithub("FAKE", ts.URL)
+			Expect(err).To(HaveOccurred())
+
+			bundle := filepath.Join(t.TempDir(), "ca.pem")
+			cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+			Expect(ioutil.WriteFile(bundle, cert, 0644)).To(Succeed())
+			Expect(os.Setenv("SSL_CERT_FILE", bundle)).To(Succeed())
+			defer os.Unsetenv("SSL_CERT_FILE")
+
+			github, err := NewGithub("FAKE", ts.URL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(github.validateToken()).To(BeTrue())
+		})
+	})
+
 	when("a github oauth token is supplied", func() {
 		it("validates the github token successfully when the token is correct", func(){
 			response := `{
@@ -0,0 +1,43 @@
+package packages
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultHookTimeout applies to post-install hooks that do not configure a timeout
+const defaultHookTimeout = 5 * time.Minute
+
+// runPostInstallHooks runs the `post_install` commands from buildpack.yml in the app directory, once packages are
+// installed. The environment set up by initializeEnv, including vendor/bin on the PATH, applies to every hook.
+func (c Contributor) runPostInstallHooks() error {
+	for _, hook := range c.composerBuildpackYAML.Composer.PostInstall {
+		if hook.Command == "" {
+			return fmt.Errorf("post_install hooks require a command")
+		}
+
+		timeout := defaultHookTimeout
+		if hook.Timeout != "" {
+			var err error
+			if timeout, err = time.ParseDuration(hook.Timeout); err != nil {
+				return fmt.Errorf("invalid timeout for post_install hook `%s`: %s", hook.Command, err)
+			}
+		}
+
+		c.composer.Logger.Body("Running post_install hook `%s`", hook.Command)
+
+		start := time.Now()
+		if err := c.composer.Runner.RunWithTimeout(timeout, "sh", c.app.Root, "-c", hook.Command); err != nil {
+			if !hook.ContinueOnError {
+				return fmt.Errorf("post_install hook `%s` failed: %s", hook.Command, err)
+			}
+
+			c.composer.Logger.BodyWarning("post_install hook `%s` failed, continuing: %s", hook.Command, err)
+			continue
+		}
+
+		c.composer.Logger.Body("Completed post_install hook `%s` in %s", hook.Command, time.Since(start).Round(time.Millisecond))
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package packages
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+	"github.com/paketo-buildpacks/php-composer/runner"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitHooks(t *testing.T) {
+	spec.Run(t, "Hooks", testHooks, spec.Report(report.Terminal{}))
+}
+
+func testHooks(t *testing.T, when spec.G, it spec.S) {
+	var (
+		factory    *test.BuildFactory
+		fakeRunner *runner.FakeRunner
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		factory = test.NewBuildFactory(t)
+		fakeRunner = &runner.FakeRunner{}
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+	})
+
+	when("post_install hooks are configured", func() {
+		it("runs each hook in the app directory", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"post_install": [{"command": "php artisan optimize"}, {"command": "bin/console cache:warmup", "timeout": "30s"}]}}`, fakeRunner, nil)
+
+			Expect(contributor.runPostInstallHooks()).To(Succeed())
+			Expect(fakeRunner.Calls).To(Equal([][]string{
+				{"sh", "-c", "php artisan optimize"},
+				{"sh", "-c", "bin/console cache:warmup"},
+			}))
+			Expect(fakeRunner.Cwd).To(Equal(factory.Build.Application.Root))
+		})
+
+		it("fails on the first failing hook", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"post_install": [{"command": "php artisan optimize"}, {"command": "npm run build"}]}}`, fakeRunner, nil)
+			fakeRunner.Err = errors.New("exit status 1")
+
+			Expect(contributor.runPostInstallHooks()).To(MatchError("post_install hook `php artisan optimize` failed: exit status 1"))
+			Expect(fakeRunner.Calls).To(HaveLen(1))
+		})
+
+		it("continues past failing hooks that allow it", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"post_install": [{"command": "php artisan optimize", "continue_on_error": true}, {"command": "npm run build", "continue_on_error": true}]}}`, fakeRunner, nil)
+			fakeRunner.Err = errors.New("exit status 1")
+
+			Expect(contributor.runPostInstallHooks()).To(Succeed())
+			Expect(fakeRunner.Calls).To(HaveLen(2))
+		})
+
+		it("stops a hook and the processes it started at the timeout", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"post_install": [{"command": "sleep 5; true", "timeout": "200ms"}]}}`,
+				runner.ComposerRunner{Out: &bytes.Buffer{}, Err: &bytes.Buffer{}, Logger: factory.Build.Logger}, nil)
+
+			start := time.Now()
+			Expect(contributor.runPostInstallHooks()).To(MatchError("post_install hook `sleep 5; true` failed: timed out after 200ms"))
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		})
+
+		it("rejects an invalid timeout", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"post_install": [{"command": "php artisan optimize", "timeout": "soon"}]}}`, fakeRunner, nil)
+
+			Expect(contributor.runPostInstallHooks()).To(MatchError(ContainSubstring("invalid timeout for post_install hook `php artisan optimize`")))
+			Expect(fakeRunner.Calls).To(BeEmpty())
+		})
+
+		it("rejects a hook without a command", func() {
+			contributor := newTestContributor(t, factory, `{"composer": {"post_install": [{"timeout": "1m"}]}}`, fakeRunner, nil)
+
+			Expect(contributor.runPostInstallHooks()).To(MatchError("post_install hooks require a command"))
+		})
+	})
+}
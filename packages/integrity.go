@@ -0,0 +1,91 @@
+package packages
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libcfbuildpack/helper"
+	"github.com/paketo-buildpacks/php-composer/composer"
+)
+
+// layerIntegrityProblems cheaply checks a vendor directory for the damage a partially contributed layer leaves behind
+func layerIntegrityProblems(vendorDir string) ([]string, error) {
+	problems := []string{}
+
+	if exists, err := helper.FileExists(filepath.Join(vendorDir, "autoload.php")); err != nil {
+		return nil, err
+	} else if !exists {
+		problems = append(problems, "autoload.php is missing")
+	}
+
+	if _, err := composer.LoadInstalled(filepath.Join(vendorDir, composer.InstalledJSON)); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	binDir := filepath.Join(vendorDir, "bin")
+	files, err := ioutil.ReadDir(binDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, file := range files {
+		// os.Stat follows the links Composer 1 creates in vendor/bin
+		if _, err := os.Stat(filepath.Join(binDir, file.Name())); err != nil {
+			problems = append(problems, fmt.Sprintf("bin/%s does not resolve", file.Name()))
+		}
+	}
+
+	return problems, nil
+}
+
+// repairPackagesLayer invalidates a packages layer that would be reused although its content is damaged, so that it is
+// contributed again. The content of a launch layer is only on disk when the platform restored it, and cannot be
+// checked otherwise, but is rebuilt when the build reads it. A restored layer that is contributed again loses the
+// packages of the previous build, which would otherwise pass for vendored ones.
+func (c Contributor) repairPackagesLayer() error {
+	layer := c.composerPackagesLayer
+	vendorDir := filepath.Join(layer.Root, c.composerBuildpackYAML.Composer.VendorDirectory)
+
+	if matches, err := layer.MetadataMatches(c.composerMetadata); err != nil {
+		return err
+	} else if !matches {
+		return os.RemoveAll(vendorDir)
+	}
+	if exists, err := helper.FileExists(vendorDir); err != nil {
+		return err
+	} else if !exists {
+		if !c.packagesLayerContentNeeded() {
+			return nil
+		}
+
+		c.composer.Logger.BodyWarning("The packages layer was not restored, rebuilding it for vendor_mode copy, preload and post_install hooks")
+		return c.invalidatePackagesLayer()
+	}
+
+	problems, err := layerIntegrityProblems(vendorDir)
+	if err != nil || len(problems) == 0 {
+		return err
+	}
+
+	c.composer.Logger.BodyWarning("The cached packages layer is damaged (%s), rebuilding it", strings.Join(problems, ", "))
+	return c.invalidatePackagesLayer()
+}
+
+// invalidatePackagesLayer removes the vendor directory of the packages layer and its metadata, so that it is contributed
+// again, and keeps the global packages that install_global installs to the layer
+func (c Contributor) invalidatePackagesLayer() error {
+	layer := c.composerPackagesLayer
+
+	if err := os.RemoveAll(filepath.Join(layer.Root, c.composerBuildpackYAML.Composer.VendorDirectory)); err != nil {
+		return err
+	}
+
+	if err := os.Remove(layer.Metadata); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
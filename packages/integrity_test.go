@@ -0,0 +1,88 @@
+package packages
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bplogger "github.com/buildpack/libbuildpack/logger"
+	"github.com/cloudfoundry/libcfbuildpack/layers"
+	"github.com/cloudfoundry/libcfbuildpack/logger"
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitIntegrity(t *testing.T) {
+	spec.Run(t, "Integrity", testIntegrity, spec.Report(report.Terminal{}))
+}
+
+func testIntegrity(t *testing.T, when spec.G, it spec.S) {
+	var (
+		factory     *test.BuildFactory
+		contributor Contributor
+		vendorDir   string
+		info        *bytes.Buffer
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		factory = test.NewBuildFactory(t)
+		info = &bytes.Buffer{}
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{"packages": []}`)
+
+		var err error
+		contributor, _, err = NewContributor(factory.Build, "/tmp")
+		Expect(err).NotTo(HaveOccurred())
+		contributor.composer.Logger = logger.Logger{Logger: bplogger.NewLogger(&bytes.Buffer{}, info)}
+
+		Expect(contributor.composerPackagesLayer.WriteMetadata(contributor.composerMetadata, layers.Launch)).To(Succeed())
+		vendorDir = filepath.Join(contributor.composerPackagesLayer.Root, "vendor")
+	})
+
+	it("keeps an intact reused layer", func() {
+		test.WriteFile(t, filepath.Join(vendorDir, "autoload.php"), "<?php")
+		test.WriteFile(t, filepath.Join(vendorDir, "composer", "installed.json"), `{"packages": []}`)
+		test.WriteFile(t, filepath.Join(vendorDir, "phpunit", "phpunit", "phpunit"), "#!/usr/bin/env php")
+		Expect(os.MkdirAll(filepath.Join(vendorDir, "bin"), 0755)).To(Succeed())
+		Expect(os.Symlink("../phpunit/phpunit/phpunit", filepath.Join(vendorDir, "bin", "phpunit"))).To(Succeed())
+
+		Expect(contributor.repairPackagesLayer()).To(Succeed())
+		Expect(contributor.composerPackagesLayer.MetadataMatches(contributor.composerMetadata)).To(BeTrue())
+		Expect(info.String()).To(BeEmpty())
+	})
+
+	it("invalidates a damaged reused layer", func() {
+		test.WriteFile(t, filepath.Join(vendorDir, "composer", "installed.json"), `{"packages": [`)
+		test.WriteFile(t, filepath.Join(vendorDir, "bin", "placeholder"), "")
+		Expect(os.Symlink("../phpunit/phpunit/phpunit", filepath.Join(vendorDir, "bin", "phpunit"))).To(Succeed())
+		globalBin := filepath.Join(contributor.composerPackagesLayer.Root, "global", "vendor", "bin", "php-cs-fixer")
+		test.WriteFile(t, globalBin, "#!/usr/bin/env php")
+
+		Expect(contributor.repairPackagesLayer()).To(Succeed())
+		Expect(contributor.composerPackagesLayer.MetadataMatches(contributor.composerMetadata)).To(BeFalse())
+		Expect(vendorDir).NotTo(BeAnExistingFile())
+		Expect(globalBin).To(BeARegularFile())
+		Expect(info.String()).To(ContainSubstring("The cached packages layer is damaged (autoload.php is missing, unable to parse"))
+		Expect(info.String()).To(ContainSubstring("bin/phpunit does not resolve), rebuilding it"))
+	})
+
+	it("cannot check a reused layer whose content is not on disk", func() {
+		Expect(contributor.repairPackagesLayer()).To(Succeed())
+		Expect(contributor.composerPackagesLayer.MetadataMatches(contributor.composerMetadata)).To(BeTrue())
+	})
+
+	it("removes the packages of a layer that is contributed again", func() {
+		contributor.composerMetadata.Hash = "changed"
+		test.WriteFile(t, filepath.Join(vendorDir, "composer", "installed.json"), `{"packages": []}`)
+
+		Expect(contributor.repairPackagesLayer()).To(Succeed())
+		Expect(vendorDir).NotTo(BeAnExistingFile())
+		Expect(info.String()).To(BeEmpty())
+	})
+}
@@ -0,0 +1,137 @@
+package packages
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cloudfoundry/libcfbuildpack/helper"
+	"github.com/paketo-buildpacks/php-composer/composer"
+)
+
+// licenseSeparator splits the alternatives of a license expression, e.g. "(MIT or GPL-3.0-or-later)"
+var licenseSeparator = regexp.MustCompile(`(?i)\s+or\s+`)
+
+// licenseConjunction splits the licenses that apply together, e.g. "(MIT and BSD-3-Clause)"
+var licenseConjunction = regexp.MustCompile(`(?i)\s+and\s+`)
+
+// licenseAlternatives returns the sets of licenses a package may be used under, any of which may be chosen, and all
+// licenses of which apply together. Like in SPDX, and binds tighter than or.
+func licenseAlternatives(pkg composer.LockPackage) ([][]string, error) {
+	alternatives := [][]string{}
+	for _, license := range pkg.License {
+		expression := strings.TrimSpace(license)
+		if strings.HasPrefix(expression, "(") && strings.HasSuffix(expression, ")") {
+			expression = expression[1 : len(expression)-1]
+		}
+
+		if strings.ContainsAny(expression, "()") {
+			return nil, fmt.Errorf("license %q of %s is not supported by license_policy, which does not support nested expressions", license, pkg.Name)
+		}
+
+		for _, alternative := range licenseSeparator.Split(expression, -1) {
+			licenses := []string{}
+			for _, l := range licenseConjunction.Split(alternative, -1) {
+				licenses = append(licenses, strings.TrimSpace(l))
+			}
+			alternatives = append(alternatives, licenses)
+		}
+	}
+	return alternatives, nil
+}
+
+// permitsLicenses reports whether none of the licenses are denied, and all are allowed when there is an allow list
+func permitsLicenses(policy composer.LicensePolicy, licenses []string) bool {
+	for _, license := range licenses {
+		if containsLicense(policy.Denied, license) {
+			return false
+		}
+
+		if len(policy.Allowed) > 0 && !containsLicense(policy.Allowed, license) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkLicenses fails when a package in composer.lock cannot be used under any of its licenses. It runs before
+// `composer install`, so packages with a license that is not permitted are never downloaded.
+func (c Contributor) checkLicenses() error {
+	policy := c.composerBuildpackYAML.Composer.LicensePolicy
+	if len(policy.Allowed) == 0 && len(policy.Denied) == 0 {
+		return nil
+	}
+
+	for _, denied := range policy.Denied {
+		if containsLicense(policy.Allowed, denied) {
+			return fmt.Errorf("license %s cannot be both allowed and denied by license_policy", denied)
+		}
+	}
+
+	lockPath := filepath.Join(c.composerDir, composer.ComposerLock)
+	if exists, err := helper.FileExists(lockPath); err != nil {
+		return err
+	} else if !exists {
+		// without composer.lock, licenses are checked once `composer install` resolved the packages
+		return nil
+	}
+
+	lock, err := composer.LoadLock(lockPath)
+	if err != nil {
+		return err
+	}
+
+	offending := []composer.LockPackage{}
+	for _, pkg := range lock.Installed(c.downloadsDev()) {
+		// packages without a license are only permitted without an allow list
+		alternatives, err := licenseAlternatives(pkg)
+		if err != nil {
+			return err
+		}
+
+		permitted := len(alternatives) == 0 && len(policy.Allowed) == 0
+		for _, licenses := range alternatives {
+			if permitsLicenses(policy, licenses) {
+				permitted = true
+				break
+			}
+		}
+
+		if !permitted {
+			offending = append(offending, pkg)
+		}
+	}
+
+	if len(offending) == 0 {
+		return nil
+	}
+
+	table := bytes.Buffer{}
+	writer := tabwriter.NewWriter(&table, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "PACKAGE\tVERSION\tLICENSE")
+	for _, pkg := range offending {
+		license := strings.Join(pkg.License, ", ")
+		if license == "" {
+			license = "none"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", pkg.Name, pkg.Version, license)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%d packages are not licensed under a license permitted by license_policy:\n%s", len(offending), table.String())
+}
+
+func containsLicense(licenses []string, license string) bool {
+	for _, l := range licenses {
+		if strings.EqualFold(l, license) {
+			return true
+		}
+	}
+	return false
+}
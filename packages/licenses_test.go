@@ -0,0 +1,131 @@
+package packages
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+	"github.com/paketo-buildpacks/php-composer/runner"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitLicenses(t *testing.T) {
+	spec.Run(t, "Licenses", testLicenses, spec.Report(report.Terminal{}))
+}
+
+func testLicenses(t *testing.T, when spec.G, it spec.S) {
+	var factory *test.BuildFactory
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		factory = test.NewBuildFactory(t)
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{
+			"packages": [
+				{"name": "monolog/monolog", "version": "2.3.5", "license": ["MIT"]},
+				{"name": "acme/dual", "version": "1.0.0", "license": ["GPL-3.0-only", "MIT"]},
+				{"name": "acme/copyleft", "version": "2.1.0", "license": ["GPL-3.0-only"]},
+				{"name": "acme/unlicensed", "version": "0.1.0"}
+			],
+			"packages-dev": [{"name": "acme/dev-tool", "version": "1.0.0", "license": ["AGPL-3.0-only"]}]
+		}`)
+	})
+
+	it("fails with a table of packages with denied licenses", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"license_policy": {"denied": ["gpl-3.0-only"]}}}`, nil, nil)
+
+		Expect(contributor.checkLicenses()).To(MatchError(`1 packages are not licensed under a license permitted by license_policy:
+PACKAGE        VERSION  LICENSE
+acme/copyleft  2.1.0    GPL-3.0-only
+`))
+	})
+
+	it("fails for packages without an allowed license", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"license_policy": {"allowed": ["MIT"]}}}`, nil, nil)
+
+		err := contributor.checkLicenses()
+		Expect(err).To(MatchError(ContainSubstring("2 packages are not licensed")))
+		Expect(err).To(MatchError(ContainSubstring("acme/unlicensed  0.1.0    none")))
+	})
+
+	it("checks dev packages when installing them", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"install_options": [], "license_policy": {"allowed": ["MIT", "GPL-3.0-only"]}}}`, nil, nil)
+
+		Expect(contributor.checkLicenses()).To(MatchError(ContainSubstring("acme/dev-tool")))
+	})
+
+	it("checks dev packages when installing them to the dev tools layer", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"dev_tools": true, "license_policy": {"allowed": ["MIT", "GPL-3.0-only"]}}}`, nil, nil)
+
+		Expect(contributor.checkLicenses()).To(MatchError(ContainSubstring("acme/dev-tool")))
+	})
+
+	it("permits packages under any of their licenses", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"license_policy": {"allowed": ["MIT", "GPL-3.0-only"], "denied": ["AGPL-3.0-only"]}}}`, nil, nil)
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{
+			"packages": [{"name": "acme/expression", "version": "1.0.0", "license": ["(AGPL-3.0-only or MIT)"]}]
+		}`)
+
+		Expect(contributor.checkLicenses()).To(Succeed())
+	})
+
+	it("permits packages only when all licenses of a conjunction are permitted", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"license_policy": {"allowed": ["MIT", "BSD-3-Clause"]}}}`, nil, nil)
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{
+			"packages": [
+				{"name": "acme/both", "version": "1.0.0", "license": ["(MIT and BSD-3-Clause)"]},
+				{"name": "acme/copyleft-too", "version": "1.0.0", "license": ["(MIT and GPL-3.0-only)"]},
+				{"name": "acme/either", "version": "1.0.0", "license": ["GPL-3.0-only or MIT and BSD-3-Clause"]}
+			]
+		}`)
+
+		err := contributor.checkLicenses()
+		Expect(err).To(MatchError(ContainSubstring("1 packages are not licensed")))
+		Expect(err).To(MatchError(ContainSubstring("acme/copyleft-too")))
+	})
+
+	it("rejects nested license expressions", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"license_policy": {"allowed": ["MIT"]}}}`, nil, nil)
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{
+			"packages": [{"name": "acme/nested", "version": "1.0.0", "license": ["(MIT or Apache-2.0) and BSD-3-Clause"]}]
+		}`)
+
+		Expect(contributor.checkLicenses()).To(MatchError(`license "(MIT or Apache-2.0) and BSD-3-Clause" of acme/nested is not supported by license_policy, which does not support nested expressions`))
+	})
+
+	it("rejects licenses that are both allowed and denied", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"license_policy": {"allowed": ["MIT"], "denied": ["MIT"]}}}`, nil, nil)
+
+		Expect(contributor.checkLicenses()).To(MatchError("license MIT cannot be both allowed and denied by license_policy"))
+	})
+
+	it("does not check a supplied composer.lock again after installing", func() {
+		installer := &installRunner{
+			FakeRunner: &runner.FakeRunner{Out: bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20")},
+			now:        time.Now(),
+		}
+		contributor := newTestContributor(t, factory, `{"composer": {"license_policy": {"denied": ["MIT"]}}}`, installer, nil)
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{
+			"packages": [{"name": "monolog/monolog", "version": "2.3.5", "license": ["MIT"]}]
+		}`)
+		Expect(contributor.setAppVendorDir()).To(Succeed())
+
+		// the simulated install leaves monolog/monolog out, which is only detected after the license check
+		err := contributor.contributeComposerPackages(contributor.composerPackagesLayer)
+		Expect(err).To(MatchError(ContainSubstring("installed packages do not match composer.lock")))
+	})
+
+	it("skips the check without a composer.lock", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"license_policy": {"denied": ["GPL-3.0-only"]}}}`, nil, nil)
+		Expect(os.Remove(filepath.Join(factory.Build.Application.Root, composer.ComposerLock))).To(Succeed())
+
+		Expect(contributor.checkLicenses()).To(Succeed())
+	})
+}
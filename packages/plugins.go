@@ -0,0 +1,163 @@
+package packages
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry/libcfbuildpack/helper"
+	"github.com/paketo-buildpacks/php-composer/composer"
+)
+
+const pluginType = "composer-plugin"
+
+// allowPlugins is `config.allow-plugins` from composer.json, which is either a boolean or a map of patterns
+type allowPlugins struct {
+	all      *bool
+	patterns map[string]bool
+}
+
+func (a *allowPlugins) UnmarshalJSON(buf []byte) error {
+	var all bool
+	if err := json.Unmarshal(buf, &all); err == nil {
+		a.all = &all
+		return nil
+	}
+
+	return json.Unmarshal(buf, &a.patterns)
+}
+
+// allowed reports whether the plugin is allowed (true) or denied (false), and whether any setting applies to it
+func (a allowPlugins) allowed(name string) (bool, bool) {
+	if a.all != nil {
+		return *a.all, true
+	}
+
+	for pattern, allow := range a.patterns {
+		if matchesPluginPattern(pattern, name) {
+			return allow, true
+		}
+	}
+
+	return false, false
+}
+
+// matchesPluginPattern matches a package name against an allow-plugins pattern, where `*` is a wildcard
+func matchesPluginPattern(pattern, name string) bool {
+	expression := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	return regexp.MustCompile(fmt.Sprintf("^%s$", expression)).MatchString(name)
+}
+
+func loadAllowPlugins(composerJSONPath string) (allowPlugins, error) {
+	composerJSON := struct {
+		Config struct {
+			AllowPlugins allowPlugins `json:"allow-plugins"`
+		} `json:"config"`
+	}{}
+
+	buf, err := ioutil.ReadFile(composerJSONPath)
+	if err != nil {
+		return allowPlugins{}, err
+	}
+
+	if err := json.Unmarshal(buf, &composerJSON); err != nil {
+		return allowPlugins{}, fmt.Errorf("unable to parse %s: %s", composerJSONPath, err)
+	}
+
+	return composerJSON.Config.AllowPlugins, nil
+}
+
+// configurePlugins applies the buildpack-level allow-plugins settings and warns about plugins Composer would block
+func (c Contributor) configurePlugins() error {
+	cfg := c.composerBuildpackYAML.Composer
+
+	if ok, err := c.composer.SupportsAllowPlugins(); err != nil {
+		return err
+	} else if !ok {
+		return nil
+	}
+
+	for _, pattern := range cfg.AllowPlugins {
+		for _, denied := range cfg.DenyPlugins {
+			if pattern == denied {
+				return fmt.Errorf("plugin %q cannot be in both allow_plugins and deny_plugins", pattern)
+			}
+		}
+	}
+
+	buildpackPlugins := allowPlugins{patterns: map[string]bool{}}
+	for _, pattern := range cfg.AllowPlugins {
+		buildpackPlugins.patterns[pattern] = true
+	}
+	for _, pattern := range cfg.DenyPlugins {
+		buildpackPlugins.patterns[pattern] = false
+	}
+
+	patterns := []string{}
+	for pattern := range buildpackPlugins.patterns {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		if err := c.composer.Config(fmt.Sprintf("allow-plugins.%s", pattern), fmt.Sprint(buildpackPlugins.patterns[pattern]), true); err != nil {
+			return err
+		}
+	}
+
+	lockPath := filepath.Join(c.composerDir, composer.ComposerLock)
+	if exists, err := helper.FileExists(lockPath); err != nil || !exists {
+		return err
+	}
+
+	lock, err := composer.LoadLock(lockPath)
+	if err != nil {
+		return err
+	}
+
+	projectPlugins, err := loadAllowPlugins(filepath.Join(c.composerDir, composer.ComposerJSON))
+	if err != nil {
+		return err
+	}
+
+	blocked := []string{}
+	for _, pkg := range lock.Installed(c.installsDev()) {
+		if pkg.Type != pluginType {
+			continue
+		}
+
+		// composer.json takes precedence over the global config written from buildpack.yml
+		if _, ok := projectPlugins.allowed(pkg.Name); ok {
+			continue
+		}
+
+		if _, ok := buildpackPlugins.allowed(pkg.Name); ok {
+			continue
+		}
+
+		blocked = append(blocked, pkg.Name)
+	}
+
+	if len(blocked) > 0 {
+		c.composer.Logger.BodyWarning("The following Composer plugins are not listed in `config.allow-plugins` and will not run: %s. "+
+			"Add them to `config.allow-plugins` in composer.json, or to `composer.allow_plugins` or `composer.deny_plugins` in buildpack.yml.",
+			strings.Join(blocked, ", "))
+	}
+
+	return nil
+}
+
+// installsDev reports whether require-dev packages are installed
+func (c Contributor) installsDev() bool {
+	return !containsOption(c.composerBuildpackYAML.Composer.InstallOptions, "--no-dev")
+}
+
+// downloadsDev reports whether require-dev packages are downloaded, either with the app's packages or to the dev tools
+// layer, and so must pass the same checks
+func (c Contributor) downloadsDev() bool {
+	return c.installsDev() || c.composerBuildpackYAML.Composer.DevTools
+}
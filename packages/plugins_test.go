@@ -0,0 +1,106 @@
+package packages
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+	"github.com/paketo-buildpacks/php-composer/runner"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitPlugins(t *testing.T) {
+	spec.Run(t, "Plugins", testPlugins, spec.Report(report.Terminal{}))
+}
+
+func testPlugins(t *testing.T, when spec.G, it spec.S) {
+	var (
+		factory    *test.BuildFactory
+		fakeRunner *runner.FakeRunner
+		info       *bytes.Buffer
+		pharPath   string
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		factory = test.NewBuildFactory(t)
+		fakeRunner = &runner.FakeRunner{Out: bytes.NewBufferString("Composer version 2.2.6 2022-02-04 17:00:38")}
+		info = &bytes.Buffer{}
+		pharPath = filepath.Join("/tmp", composer.ComposerPHAR)
+
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{
+			"packages": [
+				{"name": "composer/installers", "version": "v1.12.0", "type": "composer-plugin"},
+				{"name": "monolog/monolog", "version": "2.3.5", "type": "library"}
+			],
+			"packages-dev": [
+				{"name": "phpstan/extension-installer", "version": "1.1.0", "type": "composer-plugin"}
+			]
+		}`)
+	})
+
+	when("plugins are not listed in allow-plugins", func() {
+		it("warns about plugins that will be installed", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), `{}`)
+
+			Expect(newTestContributor(t, factory, "", fakeRunner, info).configurePlugins()).To(Succeed())
+			Expect(info.String()).To(ContainSubstring("will not run: composer/installers."))
+			Expect(info.String()).NotTo(ContainSubstring("phpstan/extension-installer"))
+		})
+
+		it("does nothing before Composer 2.2", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), `{}`)
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"allow_plugins": ["composer/installers"]}}`)
+			fakeRunner.Out = bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20")
+
+			Expect(newTestContributor(t, factory, "", fakeRunner, info).configurePlugins()).To(Succeed())
+			Expect(fakeRunner.Calls).To(HaveLen(1))
+			Expect(info.String()).To(BeEmpty())
+		})
+	})
+
+	when("composer.json lists the plugins", func() {
+		it("does not warn when a pattern matches", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), `{"config": {"allow-plugins": {"composer/*": false}}}`)
+
+			Expect(newTestContributor(t, factory, "", fakeRunner, info).configurePlugins()).To(Succeed())
+			Expect(info.String()).To(BeEmpty())
+		})
+
+		it("does not warn when all plugins are allowed", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), `{"config": {"allow-plugins": true}}`)
+
+			Expect(newTestContributor(t, factory, "", fakeRunner, info).configurePlugins()).To(Succeed())
+			Expect(info.String()).To(BeEmpty())
+		})
+	})
+
+	when("buildpack.yml lists plugins", func() {
+		it.Before(func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), `{}`)
+		})
+
+		it("applies them to the global config", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"allow_plugins": ["composer/installers"], "deny_plugins": ["evil/*"]}}`)
+
+			Expect(newTestContributor(t, factory, "", fakeRunner, info).configurePlugins()).To(Succeed())
+			Expect(fakeRunner.Calls).To(Equal([][]string{
+				{"php", pharPath, "-V"},
+				{"php", pharPath, "config", "-g", "allow-plugins.composer/installers", "true"},
+				{"php", pharPath, "config", "-g", "allow-plugins.evil/*", "false"},
+			}))
+			Expect(info.String()).To(BeEmpty())
+		})
+
+		it("rejects plugins that are both allowed and denied", func() {
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "buildpack.yml"), `{"composer": {"allow_plugins": ["composer/installers"], "deny_plugins": ["composer/installers"]}}`)
+
+			Expect(newTestContributor(t, factory, "", fakeRunner, info).configurePlugins()).To(MatchError(`plugin "composer/installers" cannot be in both allow_plugins and deny_plugins`))
+		})
+	})
+}
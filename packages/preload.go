@@ -0,0 +1,145 @@
+package packages
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/cloudfoundry/libcfbuildpack/helper"
+)
+
+const (
+	preloadScript = "composer-preload.php"
+	preloadIni    = "composer-preload.ini"
+)
+
+// classmapEntryPattern matches an entry of vendor/composer/autoload_classmap.php, e.g.
+// 'Monolog\\Logger' => $vendorDir . '/monolog/monolog/src/Monolog/Logger.php',
+var classmapEntryPattern = regexp.MustCompile(`^\s*'((?:[^'\\]|\\.)*)'\s*=>\s*\$(vendorDir|baseDir)\s*\.\s*'((?:[^'\\]|\\.)*)',?\s*$`)
+
+// parseClassmap returns the files of autoload_classmap.php by class name, resolved against the vendor and base dirs
+func parseClassmap(path, vendorDir, baseDir string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	classes := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		matches := classmapEntryPattern.FindStringSubmatch(scanner.Text())
+		if matches == nil {
+			continue
+		}
+
+		dir := vendorDir
+		if matches[2] == "baseDir" {
+			dir = baseDir
+		}
+
+		classes[unescapePHP(matches[1])] = filepath.Join(dir, unescapePHP(matches[3]))
+	}
+
+	return classes, scanner.Err()
+}
+
+// unescapePHP unescapes a single-quoted PHP string
+func unescapePHP(value string) string {
+	return strings.NewReplacer(`\\`, `\`, `\'`, `'`).Replace(value)
+}
+
+// writePreload generates an opcache.preload script from the classmap, and the .php.ini.d file that enables it
+func (c Contributor) writePreload() error {
+	cfg := c.composerBuildpackYAML.Composer
+	if !cfg.Preload.Enabled {
+		return nil
+	}
+
+	output, err := c.composer.Runner.RunWithOutput("php", c.app.Root, "-r", "echo PHP_VERSION;")
+	if err != nil {
+		return err
+	}
+
+	phpVersion, err := semver.NewVersion(strings.TrimSpace(output))
+	if err != nil {
+		return fmt.Errorf("unable to determine the PHP version: %s", err)
+	}
+
+	if phpVersion.LessThan(semver.MustParse("7.4.0")) {
+		c.composer.Logger.BodyWarning("OPcache preloading requires PHP 7.4 or later, not generating a preload script for PHP %s", phpVersion)
+		return nil
+	}
+
+	if !cfg.Autoloader.Optimize && !cfg.Autoloader.Authoritative {
+		c.composer.Logger.BodyWarning("The classmap only includes all classes when `autoloader.optimize` or `autoloader.authoritative` is enabled")
+	}
+
+	// the vendor directory of the app is either a link to, or a copy of, the packages layer
+	vendorDir := filepath.Join(c.app.Root, cfg.VendorDirectory)
+	classes, err := parseClassmap(filepath.Join(vendorDir, "composer", "autoload_classmap.php"), vendorDir, c.composerDir)
+	if err != nil {
+		return err
+	}
+
+	files := map[string]bool{}
+	for class, file := range classes {
+		if matchesNamespaces(class, cfg.Preload.Namespaces) {
+			files[file] = true
+		}
+	}
+
+	sorted := []string{}
+	for file := range files {
+		sorted = append(sorted, file)
+	}
+	sort.Strings(sorted)
+
+	script := bytes.NewBufferString("<?php\n\n// generated by the PHP Composer buildpack from vendor/composer/autoload_classmap.php\n")
+	for _, file := range sorted {
+		script.WriteString(fmt.Sprintf("opcache_compile_file('%s');\n", strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(file)))
+	}
+
+	scriptPath := filepath.Join(c.app.Root, ".php.ini.d", preloadScript)
+	if err := helper.WriteFile(scriptPath, 0644, script.String()); err != nil {
+		return err
+	}
+
+	preloadUser := cfg.Preload.User
+	if preloadUser == "" {
+		current, err := user.Current()
+		if err != nil {
+			return err
+		}
+		preloadUser = current.Username
+	}
+
+	c.composer.Logger.Body("Preloading %d files with OPcache", len(sorted))
+	return helper.WriteFile(filepath.Join(c.app.Root, ".php.ini.d", preloadIni), 0644,
+		fmt.Sprintf("opcache.preload = %s\nopcache.preload_user = %s\n", scriptPath, preloadUser))
+}
+
+// matchesNamespaces reports whether a class is in one of the namespaces or their sub-namespaces, or whether there are
+// no namespaces
+func matchesNamespaces(class string, namespaces []string) bool {
+	if len(namespaces) == 0 {
+		return true
+	}
+
+	for _, namespace := range namespaces {
+		// App matches App\Kernel, but not Application\Kernel
+		prefix := strings.Trim(namespace, `\`) + `\`
+		if prefix == `\` || strings.HasPrefix(class, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,92 @@
+package packages
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+	"github.com/paketo-buildpacks/php-composer/runner"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitPreload(t *testing.T) {
+	spec.Run(t, "Preload", testPreload, spec.Report(report.Terminal{}))
+}
+
+func testPreload(t *testing.T, when spec.G, it spec.S) {
+	var (
+		factory    *test.BuildFactory
+		fakeRunner *runner.FakeRunner
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		factory = test.NewBuildFactory(t)
+		fakeRunner = &runner.FakeRunner{Out: bytes.NewBufferString("7.4.21")}
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+	})
+
+	when("preloading is enabled", func() {
+		var contributor Contributor
+
+		it.Before(func() {
+			contributor = newTestContributor(t, factory, `{"composer": {"autoloader": {"optimize": true}, "preload": {"enabled": true, "namespaces": ["App\\", "Monolog\\"], "user": "www"}}}`, fakeRunner, nil)
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, "vendor", "composer", "autoload_classmap.php"), `<?php
+
+// autoload_classmap.php @generated by Composer
+
+$vendorDir = dirname(dirname(__FILE__));
+$baseDir = dirname($vendorDir);
+
+return array(
+    'App\\Kernel' => $baseDir . '/src/Kernel.php',
+    'Monolog\\Logger' => $vendorDir . '/monolog/monolog/src/Monolog/Logger.php',
+    'Psr\\Log\\LoggerInterface' => $vendorDir . '/psr/log/Psr/Log/LoggerInterface.php',
+);
+`)
+		})
+
+		it("writes a preload script for the configured namespaces", func() {
+			Expect(contributor.writePreload()).To(Succeed())
+
+			iniDir := filepath.Join(factory.Build.Application.Root, ".php.ini.d")
+			Expect(filepath.Join(iniDir, preloadScript)).To(test.HaveContent(`<?php
+
+// generated by the PHP Composer buildpack from vendor/composer/autoload_classmap.php
+opcache_compile_file('` + filepath.Join(factory.Build.Application.Root, "src/Kernel.php") + `');
+opcache_compile_file('` + filepath.Join(factory.Build.Application.Root, "vendor", "monolog/monolog/src/Monolog/Logger.php") + `');
+`))
+			Expect(filepath.Join(iniDir, preloadIni)).To(test.HaveContent("opcache.preload = " + filepath.Join(iniDir, preloadScript) + "\nopcache.preload_user = www\n"))
+			Expect(fakeRunner.Arguments).To(Equal([]string{"php", "-r", "echo PHP_VERSION;"}))
+		})
+
+		it("skips PHP versions before 7.4", func() {
+			fakeRunner.Out = bytes.NewBufferString("7.3.29")
+
+			Expect(contributor.writePreload()).To(Succeed())
+			Expect(filepath.Join(factory.Build.Application.Root, ".php.ini.d", preloadIni)).NotTo(BeAnExistingFile())
+		})
+	})
+
+	it("does nothing unless enabled", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {}}`, fakeRunner, nil)
+
+		Expect(contributor.writePreload()).To(Succeed())
+		Expect(fakeRunner.Calls).To(BeEmpty())
+	})
+
+	it("matches namespace prefixes", func() {
+		Expect(matchesNamespaces(`App\Kernel`, []string{`\App\`})).To(BeTrue())
+		Expect(matchesNamespaces(`Application\Kernel`, []string{`App\`})).To(BeFalse())
+		Expect(matchesNamespaces(`App\Http\Kernel`, []string{`App`})).To(BeTrue())
+		Expect(matchesNamespaces(`Application\Kernel`, []string{`App`})).To(BeFalse())
+		Expect(matchesNamespaces(`App\Http\Kernel`, []string{`\App\Http`})).To(BeTrue())
+		Expect(matchesNamespaces(`App\HttpCache`, []string{`App\Http`})).To(BeFalse())
+		Expect(matchesNamespaces(`Any\Class`, nil)).To(BeTrue())
+	})
+}
@@ -0,0 +1,292 @@
+package packages
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/cloudfoundry/libcfbuildpack/helper"
+	"github.com/paketo-buildpacks/php-composer/composer"
+)
+
+// licenseFilePattern matches license files, which are kept for compliance
+var licenseFilePattern = regexp.MustCompile(`(?i)^(licen[cs]e|copying|notice)`)
+
+// packageJSON is the subset of an installed package's composer.json used for pruning
+type packageJSON struct {
+	Archive struct {
+		Exclude []string `json:"exclude"`
+	} `json:"archive"`
+	Autoload map[string]json.RawMessage `json:"autoload"`
+	Bin      []string                   `json:"bin"`
+}
+
+// autoloadPaths returns the paths of a package that Composer autoloads from
+func (pkg packageJSON) autoloadPaths() []string {
+	paths := []string{}
+
+	for _, value := range pkg.Autoload {
+		// psr-4 and psr-0 map namespaces to a path or a list of paths, classmap and files list paths
+		namespaces := map[string]interface{}{}
+		list := []string{}
+		if err := json.Unmarshal(value, &namespaces); err == nil {
+			for _, v := range namespaces {
+				switch v := v.(type) {
+				case string:
+					list = append(list, v)
+				case []interface{}:
+					for _, p := range v {
+						if s, ok := p.(string); ok {
+							list = append(list, s)
+						}
+					}
+				}
+			}
+		} else if err := json.Unmarshal(value, &list); err != nil {
+			continue
+		}
+
+		for _, p := range list {
+			paths = append(paths, cleanPackagePath(p))
+		}
+	}
+
+	return paths
+}
+
+// cleanPackagePath normalizes a path relative to the package root, e.g. "./src/" to "src"
+func cleanPackagePath(p string) string {
+	return path.Clean("/" + p)[1:]
+}
+
+// prunePattern is a gitignore style pattern from archive.exclude, .gitattributes or buildpack.yml
+type prunePattern struct {
+	pattern  string
+	anchored bool
+	dirOnly  bool
+}
+
+func newPrunePattern(pattern string) prunePattern {
+	p := prunePattern{pattern: pattern}
+
+	if strings.HasSuffix(p.pattern, "/") {
+		p.dirOnly = true
+		p.pattern = strings.TrimSuffix(p.pattern, "/")
+	}
+
+	// patterns with a slash other than a trailing one are relative to the package root
+	if strings.Contains(p.pattern, "/") {
+		p.anchored = true
+		p.pattern = strings.TrimPrefix(p.pattern, "/")
+	}
+
+	return p
+}
+
+// matches reports whether the slash separated path, relative to the package root, matches the pattern
+func (p prunePattern) matches(rel string, dir bool) bool {
+	if p.pattern == "" || (p.dirOnly && !dir) {
+		return false
+	}
+
+	name := rel
+	if !p.anchored {
+		name = path.Base(rel)
+	}
+
+	matched, err := path.Match(p.pattern, name)
+	return err == nil && matched
+}
+
+// exportIgnored returns the patterns marked export-ignore in a package's .gitattributes
+func exportIgnored(packageDir string) ([]string, error) {
+	file, err := os.Open(filepath.Join(packageDir, ".gitattributes"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	patterns := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		for _, attribute := range fields[1:] {
+			if attribute == "export-ignore" {
+				patterns = append(patterns, fields[0])
+			}
+		}
+	}
+
+	return patterns, scanner.Err()
+}
+
+// prunePackage removes the files of an installed package that match its archive.exclude, its export-ignore attributes
+// or the configured patterns, and returns the number of bytes removed. Autoload paths, binaries, license files and
+// composer.json are always kept.
+func prunePackage(packageDir string, userPatterns []string) (int64, error) {
+	pkg := packageJSON{}
+	if buf, err := ioutil.ReadFile(filepath.Join(packageDir, composer.ComposerJSON)); err == nil {
+		if err := json.Unmarshal(buf, &pkg); err != nil {
+			return 0, fmt.Errorf("unable to parse %s: %s", filepath.Join(packageDir, composer.ComposerJSON), err)
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	patterns := []prunePattern{}
+	for _, p := range userPatterns {
+		patterns = append(patterns, newPrunePattern(p))
+	}
+
+	// negated excludes re-include paths, which this matcher does not support, so those packages are only pruned by
+	// the other patterns
+	negated := false
+	for _, p := range pkg.Archive.Exclude {
+		negated = negated || strings.HasPrefix(p, "!")
+	}
+	if !negated {
+		for _, p := range pkg.Archive.Exclude {
+			patterns = append(patterns, newPrunePattern(p))
+		}
+	}
+
+	ignored, err := exportIgnored(packageDir)
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range ignored {
+		patterns = append(patterns, newPrunePattern(p))
+	}
+
+	if len(patterns) == 0 {
+		return 0, nil
+	}
+
+	kept := append(pkg.autoloadPaths(), composer.ComposerJSON)
+	for _, bin := range pkg.Bin {
+		kept = append(kept, cleanPackagePath(bin))
+	}
+
+	var saved int64
+
+	// matched directories that contain kept paths, whose other content is pruned
+	partial := []string{}
+
+	err = filepath.Walk(packageDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || file == packageDir {
+			return err
+		}
+
+		rel, err := filepath.Rel(packageDir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if licenseFilePattern.MatchString(info.Name()) && !info.IsDir() {
+			return nil
+		}
+
+		ancestor := false
+		for _, k := range kept {
+			if k == "" || rel == k || strings.HasPrefix(rel, k+"/") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			ancestor = ancestor || strings.HasPrefix(k, rel+"/")
+		}
+
+		matched := false
+		for _, dir := range partial {
+			matched = matched || strings.HasPrefix(rel, dir+"/")
+		}
+		for _, p := range patterns {
+			matched = matched || p.matches(rel, info.IsDir())
+		}
+
+		if !matched {
+			return nil
+		}
+
+		if ancestor {
+			partial = append(partial, rel)
+			return nil
+		}
+
+		size, err := diskUsage(file)
+		if err != nil {
+			return err
+		}
+
+		if err := os.RemoveAll(file); err != nil {
+			return err
+		}
+		saved += size
+
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+
+	return saved, err
+}
+
+// diskUsage returns the size of the regular files in a file or directory
+func diskUsage(root string) (int64, error) {
+	var size int64
+	err := filepath.Walk(root, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return err
+	})
+	return size, err
+}
+
+// pruneVendor removes files that are not needed at runtime from the installed packages in the vendor directory
+func (c Contributor) pruneVendor(vendorDir string) error {
+	cfg := c.composerBuildpackYAML.Composer.Prune
+	if !cfg.Enabled {
+		return nil
+	}
+
+	installed, err := composer.LoadInstalled(filepath.Join(vendorDir, composer.InstalledJSON))
+	if err != nil {
+		return err
+	}
+
+	var saved int64
+	for _, pkg := range installed.Packages {
+		packageDir := filepath.Join(vendorDir, filepath.FromSlash(pkg.Name))
+		if exists, err := helper.FileExists(packageDir); err != nil {
+			return err
+		} else if !exists {
+			// packages with custom installers live outside the vendor directory
+			continue
+		}
+
+		size, err := prunePackage(packageDir, cfg.Patterns)
+		if err != nil {
+			return err
+		}
+		saved += size
+	}
+
+	c.composer.Logger.Body("Pruned %d bytes (%.1f MiB) from %d packages", saved, float64(saved)/(1<<20), len(installed.Packages))
+	return nil
+}
@@ -0,0 +1,103 @@
+package packages
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitPrune(t *testing.T) {
+	spec.Run(t, "Prune", testPrune, spec.Report(report.Terminal{}))
+}
+
+func testPrune(t *testing.T, when spec.G, it spec.S) {
+	var (
+		factory   *test.BuildFactory
+		vendorDir string
+		info      *bytes.Buffer
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		factory = test.NewBuildFactory(t)
+		info = &bytes.Buffer{}
+		vendorDir = filepath.Join(factory.Build.Layers.Layer(composer.PackagesDependency).Root, "vendor")
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+
+		test.WriteFile(t, filepath.Join(vendorDir, "composer", "installed.json"), `{"packages": [
+			{"name": "acme/excluded", "version": "1.0.0"},
+			{"name": "acme/attributes", "version": "1.0.0"},
+			{"name": "acme/negated", "version": "1.0.0"}
+		]}`)
+
+		excluded := filepath.Join(vendorDir, "acme", "excluded")
+		test.WriteFile(t, filepath.Join(excluded, "composer.json"), `{
+			"archive": {"exclude": ["/tests", "*.md", "docs/"]},
+			"autoload": {"psr-4": {"Acme\\Excluded\\": "src/"}, "files": ["tests/bootstrap.php"]},
+			"bin": ["./bin/excluded"]
+		}`)
+		test.WriteFile(t, filepath.Join(excluded, "src", "Excluded.php"), "<?php class Excluded {}")
+		test.WriteFile(t, filepath.Join(excluded, "src", "README.md"), "kept inside an autoload path")
+		test.WriteFile(t, filepath.Join(excluded, "tests", "bootstrap.php"), "<?php")
+		test.WriteFile(t, filepath.Join(excluded, "tests", "ExcludedTest.php"), "<?php")
+		test.WriteFile(t, filepath.Join(excluded, "docs", "index.rst"), "0123456789")
+		test.WriteFile(t, filepath.Join(excluded, "README.md"), "01234")
+		test.WriteFile(t, filepath.Join(excluded, "LICENSE.md"), "MIT")
+		test.WriteFile(t, filepath.Join(excluded, "bin", "excluded"), "#!/usr/bin/env php")
+
+		attributes := filepath.Join(vendorDir, "acme", "attributes")
+		test.WriteFile(t, filepath.Join(attributes, "composer.json"), `{"autoload": {"classmap": ["lib"]}}`)
+		test.WriteFile(t, filepath.Join(attributes, ".gitattributes"), "# release\n/examples export-ignore\n.travis.yml export-ignore\n*.php text eol=lf\n")
+		test.WriteFile(t, filepath.Join(attributes, "lib", "Attributes.php"), "<?php")
+		test.WriteFile(t, filepath.Join(attributes, "examples", "example.php"), "01234")
+		test.WriteFile(t, filepath.Join(attributes, ".travis.yml"), "01")
+
+		negated := filepath.Join(vendorDir, "acme", "negated")
+		test.WriteFile(t, filepath.Join(negated, "composer.json"), `{"archive": {"exclude": ["/docs", "!/docs/api.md"]}, "autoload": {"psr-4": {"Acme\\Negated\\": "src"}}}`)
+		test.WriteFile(t, filepath.Join(negated, "docs", "api.md"), "kept")
+		test.WriteFile(t, filepath.Join(negated, "phpunit.xml.dist"), "012")
+	})
+
+	it("prunes excluded paths and keeps autoload paths, binaries and licenses", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"prune": {"enabled": true, "patterns": ["phpunit.xml.dist"]}}}`, nil, info)
+
+		Expect(contributor.pruneVendor(vendorDir)).To(Succeed())
+
+		excluded := filepath.Join(vendorDir, "acme", "excluded")
+		Expect(filepath.Join(excluded, "src", "Excluded.php")).To(BeARegularFile())
+		Expect(filepath.Join(excluded, "src", "README.md")).To(BeARegularFile())
+		Expect(filepath.Join(excluded, "tests", "bootstrap.php")).To(BeARegularFile())
+		Expect(filepath.Join(excluded, "tests", "ExcludedTest.php")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(excluded, "docs")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(excluded, "README.md")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(excluded, "LICENSE.md")).To(BeARegularFile())
+		Expect(filepath.Join(excluded, "bin", "excluded")).To(BeARegularFile())
+
+		attributes := filepath.Join(vendorDir, "acme", "attributes")
+		Expect(filepath.Join(attributes, "lib", "Attributes.php")).To(BeARegularFile())
+		Expect(filepath.Join(attributes, "examples")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(attributes, ".travis.yml")).NotTo(BeAnExistingFile())
+
+		negated := filepath.Join(vendorDir, "acme", "negated")
+		Expect(filepath.Join(negated, "docs", "api.md")).To(BeARegularFile())
+		Expect(filepath.Join(negated, "phpunit.xml.dist")).NotTo(BeAnExistingFile())
+
+		// <?php (5) + docs (10) + README.md (5) + examples (5) + .travis.yml (2) + phpunit.xml.dist (3)
+		Expect(info.String()).To(ContainSubstring("Pruned 30 bytes (0.0 MiB) from 3 packages"))
+	})
+
+	it("does nothing unless enabled", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {}}`, nil, info)
+
+		Expect(contributor.pruneVendor(vendorDir)).To(Succeed())
+		Expect(filepath.Join(vendorDir, "acme", "excluded", "docs")).To(BeADirectory())
+		Expect(info.String()).To(BeEmpty())
+	})
+}
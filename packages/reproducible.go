@@ -0,0 +1,67 @@
+package packages
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/libcfbuildpack/helper"
+	"github.com/paketo-buildpacks/php-composer/composer"
+	"golang.org/x/sys/unix"
+)
+
+// defaultBuildTime is the timestamp the lifecycle gives layer files, used unless SOURCE_DATE_EPOCH is set
+var defaultBuildTime = time.Date(1980, time.January, 1, 0, 0, 1, 0, time.UTC)
+
+// buildTime returns the timestamp of generated files and metadata, so that rebuilding from the same composer.lock
+// produces identical layers
+func buildTime() (time.Time, error) {
+	epoch, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	if !ok || epoch == "" {
+		return defaultBuildTime, nil
+	}
+
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %s", epoch, err)
+	}
+
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// normalizeTimestamps sets the access and modification times of everything under root, including symlinks, to the
+// build time
+func normalizeTimestamps(root string) error {
+	t, err := buildTime()
+	if err != nil {
+		return err
+	}
+
+	times := []unix.Timeval{unix.NsecToTimeval(t.UnixNano()), unix.NsecToTimeval(t.UnixNano())}
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := unix.Lutimes(path, times); err != nil {
+			return fmt.Errorf("unable to set the timestamps of %s: %s", path, err)
+		}
+		return nil
+	})
+}
+
+// configureAutoloaderSuffix derives Composer's autoloader suffix from composer.lock, since Composer otherwise
+// generates a random one for the class names in vendor/composer/autoload_*.php
+func (c Contributor) configureAutoloaderSuffix() error {
+	if exists, err := helper.FileExists(filepath.Join(c.composerDir, composer.ComposerLock)); err != nil {
+		return err
+	} else if !exists {
+		return nil
+	}
+
+	// the metadata hash is the SHA-256 of composer.lock, Composer's own suffixes are 32 hex characters
+	return c.composer.Config("autoloader-suffix", c.composerMetadata.Hash[:32], true)
+}
@@ -0,0 +1,194 @@
+package packages
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+	"github.com/paketo-buildpacks/php-composer/runner"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+// installRunner simulates `composer install` writing the vendor directory at the current time, with the configured
+// autoloader suffix or a random one like Composer's, and `composer global require` linking each package to bin
+type installRunner struct {
+	*runner.FakeRunner
+	suffix string
+	now    time.Time
+}
+
+func (r *installRunner) Run(bin, dir string, args ...string) error {
+	if len(args) == 5 && args[1] == "config" && args[3] == "autoloader-suffix" {
+		r.suffix = args[4]
+	}
+
+	if len(args) > 3 && args[1] == "global" {
+		binDir := filepath.Join(os.Getenv("COMPOSER_VENDOR_DIR"), "bin")
+		if err := os.MkdirAll(binDir, 0755); err != nil {
+			return err
+		}
+		for _, pkg := range args[4:] {
+			if err := ioutil.WriteFile(filepath.Join(binDir, filepath.Base(pkg)), []byte("#!/usr/bin/env php"), 0755); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(args) > 1 && args[1] == "install" {
+		suffix := r.suffix
+		if suffix == "" {
+			suffix = fmt.Sprintf("%x", rand.Int63())
+		}
+
+		vendorDir := os.Getenv("COMPOSER_VENDOR_DIR")
+		files := map[string]string{
+			"autoload.php": fmt.Sprintf("<?php\nreturn ComposerAutoloaderInit%s::getLoader();\n", suffix),
+			filepath.Join("composer", "installed.json"):    `{"packages": []}`,
+			filepath.Join("phpunit", "phpunit", "phpunit"): "#!/usr/bin/env php",
+		}
+		for name, content := range files {
+			if err := os.MkdirAll(filepath.Dir(filepath.Join(vendorDir, name)), 0755); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(filepath.Join(vendorDir, name), []byte(content), 0644); err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(filepath.Join(vendorDir, "bin"), 0755); err != nil {
+			return err
+		}
+		if err := os.Symlink("../phpunit/phpunit/phpunit", filepath.Join(vendorDir, "bin", "phpunit")); err != nil {
+			return err
+		}
+
+		if err := filepath.Walk(vendorDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.Mode()&os.ModeSymlink != 0 {
+				return err
+			}
+			return os.Chtimes(path, r.now, r.now)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return r.FakeRunner.Run(bin, dir, args...)
+}
+
+// layerTarball archives a directory the way a layer is exported, in walk order with paths relative to the root
+func layerTarball(t *testing.T, root string) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	writer := tar.NewWriter(buf)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		if header.Name, err = filepath.Rel(root, path); err != nil {
+			return err
+		}
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+		if err := writer.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(writer, file)
+		return err
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(writer.Close()).To(Succeed())
+
+	return buf.Bytes()
+}
+
+func TestUnitReproducible(t *testing.T) {
+	spec.Run(t, "Reproducible", testReproducible, spec.Report(report.Terminal{}))
+}
+
+func testReproducible(t *testing.T, when spec.G, it spec.S) {
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	when("determining the build time", func() {
+		it.After(func() {
+			Expect(os.Unsetenv("SOURCE_DATE_EPOCH")).To(Succeed())
+		})
+
+		it("defaults to the lifecycle's layer timestamp", func() {
+			Expect(buildTime()).To(Equal(time.Date(1980, time.January, 1, 0, 0, 1, 0, time.UTC)))
+		})
+
+		it("uses SOURCE_DATE_EPOCH", func() {
+			Expect(os.Setenv("SOURCE_DATE_EPOCH", "1600000000")).To(Succeed())
+			Expect(buildTime()).To(Equal(time.Unix(1600000000, 0).UTC()))
+		})
+
+		it("rejects an invalid SOURCE_DATE_EPOCH", func() {
+			Expect(os.Setenv("SOURCE_DATE_EPOCH", "yesterday")).To(Succeed())
+			_, err := buildTime()
+			Expect(err).To(MatchError(ContainSubstring(`invalid SOURCE_DATE_EPOCH "yesterday"`)))
+		})
+	})
+
+	when("building twice from the same composer.lock", func() {
+		build := func(now time.Time) []byte {
+			factory := test.NewBuildFactory(t)
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), `{"require": {"phpunit/phpunit": "^9"}}`)
+			test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{"packages": []}`)
+
+			contributor, _, err := NewContributor(factory.Build, "/tmp")
+			Expect(err).NotTo(HaveOccurred())
+			contributor.composer.Runner = &installRunner{
+				FakeRunner: &runner.FakeRunner{Out: bytes.NewBufferString("Composer version 2.1.3 2021-06-09 16:31:20")},
+				now:        now,
+			}
+
+			layer := contributor.composerPackagesLayer
+			Expect(contributor.setAppVendorDir()).To(Succeed())
+			Expect(contributor.contributeComposerPackages(layer)).To(Succeed())
+
+			return layerTarball(t, layer.Root)
+		}
+
+		it("produces identical packages layers", func() {
+			first := build(time.Now())
+			second := build(time.Now().Add(time.Hour))
+
+			Expect(first).To(Equal(second))
+			Expect(string(first)).To(ContainSubstring("ComposerAutoloaderInitf251a533f4bd04a48977784d130de125"))
+		})
+	})
+}
@@ -0,0 +1,287 @@
+package packages
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/libcfbuildpack/helper"
+	"github.com/cloudfoundry/libcfbuildpack/layers"
+	"github.com/paketo-buildpacks/php-composer/composer"
+)
+
+const (
+	CycloneDXFormat = "cyclonedx"
+	SPDXFormat      = "spdx"
+
+	CycloneDXFile = "sbom.cdx.json"
+	SPDXFile      = "sbom.spdx.json"
+
+	sbomTool = "paketo-buildpacks/php-composer"
+)
+
+type cycloneDXDocument struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string          `json:"timestamp"`
+	Tools     []cycloneDXTool `json:"tools"`
+}
+
+type cycloneDXTool struct {
+	Name string `json:"name"`
+}
+
+type cycloneDXComponent struct {
+	Type               string                       `json:"type"`
+	Group              string                       `json:"group,omitempty"`
+	Name               string                       `json:"name"`
+	Version            string                       `json:"version"`
+	PURL               string                       `json:"purl"`
+	Licenses           []cycloneDXLicense           `json:"licenses,omitempty"`
+	Hashes             []cycloneDXHash              `json:"hashes,omitempty"`
+	ExternalReferences []cycloneDXExternalReference `json:"externalReferences,omitempty"`
+}
+
+type cycloneDXLicense struct {
+	License cycloneDXLicenseInfo `json:"license"`
+}
+
+// cycloneDXLicenseInfo has either the SPDX identifier or the name of a license
+type cycloneDXLicenseInfo struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXExternalReference struct {
+	Type    string `json:"type"`
+	URL     string `json:"url"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type spdxDocument struct {
+	SPDXVersion       string           `json:"spdxVersion"`
+	DataLicense       string           `json:"dataLicense"`
+	SPDXID            string           `json:"SPDXID"`
+	Name              string           `json:"name"`
+	DocumentNamespace string           `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo `json:"creationInfo"`
+	Packages          []spdxPackage    `json:"packages"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+var spdxIDPattern = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// purl returns the package URL of a Composer package, see https://github.com/package-url/purl-spec
+func purl(pkg composer.LockPackage) string {
+	return fmt.Sprintf("pkg:composer/%s@%s", pkg.Name, pkg.Version)
+}
+
+// newCycloneDX describes the packages as a CycloneDX 1.4 document
+func newCycloneDX(packages []composer.LockPackage, hash string, created time.Time) cycloneDXDocument {
+	components := []cycloneDXComponent{}
+	for _, pkg := range packages {
+		component := cycloneDXComponent{Type: "library", Name: pkg.Name, Version: pkg.Version, PURL: purl(pkg)}
+		if i := strings.Index(pkg.Name, "/"); i >= 0 {
+			component.Group, component.Name = pkg.Name[:i], pkg.Name[i+1:]
+		}
+
+		for _, license := range pkg.License {
+			info := cycloneDXLicenseInfo{Name: license}
+			if id, ok := spdxLicenseID(license); ok {
+				info = cycloneDXLicenseInfo{ID: id}
+			}
+			component.Licenses = append(component.Licenses, cycloneDXLicense{info})
+		}
+
+		if pkg.Source != nil && pkg.Source.URL != "" {
+			component.ExternalReferences = append(component.ExternalReferences,
+				cycloneDXExternalReference{Type: "vcs", URL: pkg.Source.URL, Comment: pkg.Source.Reference})
+		}
+
+		if pkg.Dist != nil && pkg.Dist.URL != "" {
+			component.ExternalReferences = append(component.ExternalReferences,
+				cycloneDXExternalReference{Type: "distribution", URL: pkg.Dist.URL})
+			if pkg.Dist.Shasum != "" {
+				component.Hashes = append(component.Hashes, cycloneDXHash{"SHA-1", pkg.Dist.Shasum})
+			}
+		}
+
+		components = append(components, component)
+	}
+
+	// the serial number is a UUID derived from the hash, so the same packages always produce the same serial number
+	serial := fmt.Sprintf("urn:uuid:%s-%s-%s-%s-%s", hash[0:8], hash[8:12], hash[12:16], hash[16:20], hash[20:32])
+
+	return cycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: serial,
+		Version:      1,
+		Metadata:     cycloneDXMetadata{created.UTC().Format(time.RFC3339), []cycloneDXTool{{sbomTool}}},
+		Components:   components,
+	}
+}
+
+// newSPDX describes the packages as an SPDX 2.3 document
+func newSPDX(packages []composer.LockPackage, hash string, created time.Time) spdxDocument {
+	spdxPackages := []spdxPackage{}
+	for _, pkg := range packages {
+		p := spdxPackage{
+			Name:             pkg.Name,
+			SPDXID:           "SPDXRef-Package-" + spdxIDPattern.ReplaceAllString(pkg.Name+"-"+pkg.Version, "-"),
+			VersionInfo:      pkg.Version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			ExternalRefs:     []spdxExternalRef{{"PACKAGE-MANAGER", "purl", purl(pkg)}},
+		}
+
+		// Composer lists the licenses of dual-licensed packages, any of which may be chosen. Licenses without an SPDX
+		// identifier cannot be part of the license expression.
+		ids := []string{}
+		for _, license := range pkg.License {
+			if id, ok := spdxLicenseID(license); ok {
+				ids = append(ids, id)
+			}
+		}
+
+		if len(ids) < len(pkg.License) {
+			p.LicenseDeclared = "NOASSERTION"
+		} else if len(ids) == 1 {
+			p.LicenseDeclared = ids[0]
+		} else if len(ids) > 1 {
+			p.LicenseDeclared = "(" + strings.Join(ids, " OR ") + ")"
+		}
+
+		if pkg.Source != nil && pkg.Source.URL != "" {
+			p.SourceInfo = fmt.Sprintf("%s %s at %s", pkg.Source.Type, pkg.Source.URL, pkg.Source.Reference)
+			p.DownloadLocation = pkg.Source.URL
+		}
+
+		if pkg.Dist != nil && pkg.Dist.URL != "" {
+			p.DownloadLocation = pkg.Dist.URL
+			if pkg.Dist.Shasum != "" {
+				p.Checksums = []spdxChecksum{{"SHA1", pkg.Dist.Shasum}}
+			}
+		}
+
+		spdxPackages = append(spdxPackages, p)
+	}
+
+	return spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              "php-composer-packages",
+		DocumentNamespace: fmt.Sprintf("https://paketo.io/spdx/php-composer/%s", hash),
+		CreationInfo:      spdxCreationInfo{created.UTC().Format(time.RFC3339), []string{"Tool: " + sbomTool}},
+		Packages:          spdxPackages,
+	}
+}
+
+// contributeSBOM writes the configured SBOM formats for the installed packages in composer.lock to a launch layer
+func (c Contributor) contributeSBOM() error {
+	formats := c.composerBuildpackYAML.Composer.SBOM
+	if len(formats) == 0 {
+		return nil
+	}
+
+	for _, format := range formats {
+		if format != CycloneDXFormat && format != SPDXFormat {
+			return fmt.Errorf("unsupported sbom format %q, use %q or %q", format, CycloneDXFormat, SPDXFormat)
+		}
+	}
+
+	// composer.lock exists here even without an app-supplied one, since `composer install` writes it
+	lockPath := filepath.Join(c.composerDir, composer.ComposerLock)
+	buf, err := ioutil.ReadFile(lockPath)
+	if err != nil {
+		return err
+	}
+
+	lock, err := composer.LoadLock(lockPath)
+	if err != nil {
+		return err
+	}
+
+	dev := c.installsDev()
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s %t %s", strings.Join(formats, ","), dev, buf)))
+	metadata := Metadata{Name: "PHP Composer SBOM", Hash: hex.EncodeToString(hash[:])}
+
+	return c.sbomLayer.Contribute(metadata, func(layer layers.Layer) error {
+		packages := lock.Installed(dev)
+		created, err := buildTime()
+		if err != nil {
+			return err
+		}
+
+		for _, format := range formats {
+			var document interface{}
+			file := CycloneDXFile
+			if format == CycloneDXFormat {
+				document = newCycloneDX(packages, metadata.Hash, created)
+			} else {
+				document = newSPDX(packages, metadata.Hash, created)
+				file = SPDXFile
+			}
+
+			content, err := json.MarshalIndent(document, "", "  ")
+			if err != nil {
+				return err
+			}
+
+			layer.Logger.Body("Writing %s SBOM for %d packages", format, len(packages))
+			if err := helper.WriteFile(filepath.Join(layer.Root, file), 0644, string(content)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, layers.Launch)
+}
@@ -0,0 +1,147 @@
+package packages
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/libcfbuildpack/test"
+	"github.com/paketo-buildpacks/php-composer/composer"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitSBOM(t *testing.T) {
+	spec.Run(t, "SBOM", testSBOM, spec.Report(report.Terminal{}))
+}
+
+func testSBOM(t *testing.T, when spec.G, it spec.S) {
+	var factory *test.BuildFactory
+
+	monolog := composer.LockPackage{
+		Name:    "monolog/monolog",
+		Version: "2.3.5",
+		Type:    "library",
+		License: []string{"MIT"},
+		Source:  &composer.LockReference{Type: "git", URL: "https://github.com/Seldaek/monolog.git", Reference: "fd4380d6"},
+		Dist:    &composer.LockReference{Type: "zip", URL: "https://api.github.com/repos/Seldaek/monolog/zipball/fd4380d6", Shasum: "da39a3ee"},
+	}
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		factory = test.NewBuildFactory(t)
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerJSON), "")
+		test.WriteFile(t, filepath.Join(factory.Build.Application.Root, composer.ComposerLock), `{
+			"packages": [{
+				"name": "monolog/monolog", "version": "2.3.5", "type": "library", "license": ["MIT"],
+				"source": {"type": "git", "url": "https://github.com/Seldaek/monolog.git", "reference": "fd4380d6"},
+				"dist": {"type": "zip", "url": "https://api.github.com/repos/Seldaek/monolog/zipball/fd4380d6", "reference": "fd4380d6", "shasum": "da39a3ee"}
+			}],
+			"packages-dev": [{"name": "phpunit/phpunit", "version": "9.5.10", "type": "library", "license": ["BSD-3-Clause"]}]
+		}`)
+	})
+
+	it("describes packages as CycloneDX", func() {
+		document := newCycloneDX([]composer.LockPackage{monolog}, "0123456789abcdef0123456789abcdef", time.Unix(0, 0))
+
+		Expect(document.SerialNumber).To(Equal("urn:uuid:01234567-89ab-cdef-0123-456789abcdef"))
+		Expect(document.Metadata.Timestamp).To(Equal("1970-01-01T00:00:00Z"))
+		Expect(document.Components).To(Equal([]cycloneDXComponent{{
+			Type:     "library",
+			Group:    "monolog",
+			Name:     "monolog",
+			Version:  "2.3.5",
+			PURL:     "pkg:composer/monolog/monolog@2.3.5",
+			Licenses: []cycloneDXLicense{{cycloneDXLicenseInfo{ID: "MIT"}}},
+			Hashes:   []cycloneDXHash{{"SHA-1", "da39a3ee"}},
+			ExternalReferences: []cycloneDXExternalReference{
+				{Type: "vcs", URL: "https://github.com/Seldaek/monolog.git", Comment: "fd4380d6"},
+				{Type: "distribution", URL: "https://api.github.com/repos/Seldaek/monolog/zipball/fd4380d6"},
+			},
+		}}))
+	})
+
+	it("describes packages as SPDX", func() {
+		dualLicensed := composer.LockPackage{Name: "symfony/polyfill-php80", Version: "v1.23.1", License: []string{"MIT", "Apache-2.0"}}
+		document := newSPDX([]composer.LockPackage{monolog, dualLicensed}, "0123", time.Unix(0, 0))
+
+		Expect(document.DocumentNamespace).To(Equal("https://paketo.io/spdx/php-composer/0123"))
+		Expect(document.Packages[0]).To(Equal(spdxPackage{
+			Name:             "monolog/monolog",
+			SPDXID:           "SPDXRef-Package-monolog-monolog-2.3.5",
+			VersionInfo:      "2.3.5",
+			DownloadLocation: "https://api.github.com/repos/Seldaek/monolog/zipball/fd4380d6",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "MIT",
+			SourceInfo:       "git https://github.com/Seldaek/monolog.git at fd4380d6",
+			Checksums:        []spdxChecksum{{"SHA1", "da39a3ee"}},
+			ExternalRefs:     []spdxExternalRef{{"PACKAGE-MANAGER", "purl", "pkg:composer/monolog/monolog@2.3.5"}},
+		}))
+		Expect(document.Packages[1].LicenseDeclared).To(Equal("(MIT OR Apache-2.0)"))
+		Expect(document.Packages[1].DownloadLocation).To(Equal("NOASSERTION"))
+	})
+
+	it("describes licenses without an SPDX identifier by name", func() {
+		proprietary := composer.LockPackage{Name: "acme/internal", Version: "1.0.0", License: []string{"proprietary", "mit"}}
+
+		cycloneDX := newCycloneDX([]composer.LockPackage{proprietary}, "0123456789abcdef0123456789abcdef", time.Unix(0, 0))
+		Expect(cycloneDX.Components[0].Licenses).To(Equal([]cycloneDXLicense{
+			{cycloneDXLicenseInfo{Name: "proprietary"}},
+			{cycloneDXLicenseInfo{ID: "MIT"}},
+		}))
+
+		content, err := json.Marshal(cycloneDX.Components[0].Licenses)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal(`[{"license":{"name":"proprietary"}},{"license":{"id":"MIT"}}]`))
+
+		spdx := newSPDX([]composer.LockPackage{proprietary}, "0123", time.Unix(0, 0))
+		Expect(spdx.Packages[0].LicenseDeclared).To(Equal("NOASSERTION"))
+	})
+
+	it("writes the configured formats to a launch layer without dev packages", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"sbom": ["cyclonedx", "spdx"]}}`, nil, nil)
+
+		Expect(contributor.contributeSBOM()).To(Succeed())
+
+		layer := factory.Build.Layers.Layer(composer.SBOMDependency)
+		Expect(layer).To(test.HaveLayerMetadata(false, false, true))
+
+		buf, err := ioutil.ReadFile(filepath.Join(layer.Root, CycloneDXFile))
+		Expect(err).NotTo(HaveOccurred())
+		cyclonedx := cycloneDXDocument{}
+		Expect(json.Unmarshal(buf, &cyclonedx)).To(Succeed())
+		Expect(cyclonedx.Components).To(HaveLen(1))
+		Expect(cyclonedx.Components[0].PURL).To(Equal("pkg:composer/monolog/monolog@2.3.5"))
+
+		Expect(filepath.Join(layer.Root, SPDXFile)).To(BeARegularFile())
+	})
+
+	it("includes dev packages when installing them", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"install_options": [], "sbom": ["spdx"]}}`, nil, nil)
+
+		Expect(contributor.contributeSBOM()).To(Succeed())
+
+		buf, err := ioutil.ReadFile(filepath.Join(factory.Build.Layers.Layer(composer.SBOMDependency).Root, SPDXFile))
+		Expect(err).NotTo(HaveOccurred())
+		spdx := spdxDocument{}
+		Expect(json.Unmarshal(buf, &spdx)).To(Succeed())
+		Expect(spdx.Packages).To(HaveLen(2))
+	})
+
+	it("rejects unsupported formats", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {"sbom": ["syft"]}}`, nil, nil)
+
+		Expect(contributor.contributeSBOM()).To(MatchError(`unsupported sbom format "syft", use "cyclonedx" or "spdx"`))
+	})
+
+	it("does nothing without configured formats", func() {
+		contributor := newTestContributor(t, factory, `{"composer": {}}`, nil, nil)
+
+		Expect(contributor.contributeSBOM()).To(Succeed())
+		Expect(factory.Build.Layers.Layer(composer.SBOMDependency).Root).NotTo(BeADirectory())
+	})
+}
@@ -0,0 +1,28 @@
+package packages
+
+import "strings"
+
+// spdxLicenses are the SPDX license identifiers of the licenses common in Composer packages, including the deprecated
+// ones older packages declare. Other licenses, such as "proprietary", are described by name.
+var spdxLicenses = []string{
+	"0BSD", "AFL-3.0", "AGPL-1.0", "AGPL-3.0", "AGPL-3.0-only", "AGPL-3.0-or-later", "Apache-1.0", "Apache-1.1",
+	"Apache-2.0", "APSL-2.0", "Artistic-1.0", "Artistic-2.0", "BSD-1-Clause", "BSD-2-Clause", "BSD-2-Clause-Patent",
+	"BSD-3-Clause", "BSD-3-Clause-Clear", "BSD-4-Clause", "BSL-1.0", "CC-BY-3.0", "CC-BY-4.0", "CC-BY-SA-3.0",
+	"CC-BY-SA-4.0", "CC0-1.0", "CDDL-1.0", "CDDL-1.1", "CECILL-2.1", "CPL-1.0", "ECL-2.0", "EPL-1.0", "EPL-2.0",
+	"EUPL-1.1", "EUPL-1.2", "GPL-1.0", "GPL-1.0+", "GPL-1.0-only", "GPL-1.0-or-later", "GPL-2.0", "GPL-2.0+",
+	"GPL-2.0-only", "GPL-2.0-or-later", "GPL-3.0", "GPL-3.0+", "GPL-3.0-only", "GPL-3.0-or-later", "ISC", "LGPL-2.0",
+	"LGPL-2.0+", "LGPL-2.0-only", "LGPL-2.0-or-later", "LGPL-2.1", "LGPL-2.1+", "LGPL-2.1-only", "LGPL-2.1-or-later",
+	"LGPL-3.0", "LGPL-3.0+", "LGPL-3.0-only", "LGPL-3.0-or-later", "MIT", "MIT-0", "MPL-1.0", "MPL-1.1", "MPL-2.0",
+	"MS-PL", "MS-RL", "NCSA", "OFL-1.1", "OSL-3.0", "PHP-3.0", "PHP-3.01", "PostgreSQL", "Python-2.0", "Ruby",
+	"Unlicense", "UPL-1.0", "W3C", "WTFPL", "X11", "Zend-2.0", "Zlib", "ZPL-2.1",
+}
+
+// spdxLicenseID returns the SPDX identifier of a license in its canonical case, SPDX identifiers are case-insensitive
+func spdxLicenseID(license string) (string, bool) {
+	for _, id := range spdxLicenses {
+		if strings.EqualFold(id, license) {
+			return id, true
+		}
+	}
+	return "", false
+}
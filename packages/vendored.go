@@ -0,0 +1,47 @@
+package packages
+
+import (
+	"path/filepath"
+
+	"github.com/cloudfoundry/libcfbuildpack/helper"
+	"github.com/cloudfoundry/libcfbuildpack/layers"
+	"github.com/paketo-buildpacks/php-composer/composer"
+)
+
+// vendoredPackagesMatch reports whether a vendor directory supplied with the app already contains exactly the packages
+// in composer.lock, so that `composer install` can be skipped. Before installing, only SetupVendorDir populates the
+// vendor directory of the layer, since repairPackagesLayer removes the packages a restored layer was built with.
+func (c Contributor) vendoredPackagesMatch(layer layers.Layer) (bool, error) {
+	installedPath := filepath.Join(layer.Root, c.composerBuildpackYAML.Composer.VendorDirectory, composer.InstalledJSON)
+	lockPath := filepath.Join(c.composerDir, composer.ComposerLock)
+
+	for _, path := range []string{installedPath, lockPath} {
+		if exists, err := helper.FileExists(path); err != nil || !exists {
+			return false, err
+		}
+	}
+
+	installed, err := composer.LoadInstalled(installedPath)
+	if err != nil {
+		c.composer.Logger.BodyWarning("Ignoring vendored packages: %s", err)
+		return false, nil
+	}
+
+	lock, err := composer.LoadLock(lockPath)
+	if err != nil {
+		return false, err
+	}
+
+	diff := installed.Diff(lock.Installed(c.installsDev()))
+	if len(diff) == 0 {
+		c.composer.Logger.Body("Vendored packages match %s, skipping composer install", composer.ComposerLock)
+		return true, nil
+	}
+
+	c.composer.Logger.Body("Vendored packages differ from %s, running composer install:", composer.ComposerLock)
+	for _, line := range diff {
+		c.composer.Logger.Body("  %s", line)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,52 @@
+package packages
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libcfbuildpack/helper"
+	"github.com/cloudfoundry/libcfbuildpack/layers"
+	"github.com/paketo-buildpacks/php-composer/composer"
+)
+
+// verifyVendor fails the contribution of the packages layer unless its vendor directory has an autoloader and
+// installed.json lists exactly the packages in composer.lock, so a half-installed vendor directory is never exported
+func (c Contributor) verifyVendor(layer layers.Layer, options []string) error {
+	cfg := c.composerBuildpackYAML.Composer
+	vendorDir := filepath.Join(layer.Root, cfg.VendorDirectory)
+	problems := []string{}
+
+	// with --no-autoloader, only dumpAutoload generates an autoloader
+	if !containsOption(options, noAutoloaderOption) || cfg.Autoloader != (composer.Autoloader{}) {
+		if exists, err := helper.FileExists(filepath.Join(vendorDir, "autoload.php")); err != nil {
+			return err
+		} else if !exists {
+			problems = append(problems, fmt.Sprintf("%s is missing", filepath.Join(cfg.VendorDirectory, "autoload.php")))
+		}
+	}
+
+	installedPath := filepath.Join(vendorDir, composer.InstalledJSON)
+	lockPath := filepath.Join(c.composerDir, composer.ComposerLock)
+	if exists, err := helper.FileExists(installedPath); err != nil {
+		return err
+	} else if !exists {
+		problems = append(problems, fmt.Sprintf("%s is missing", filepath.Join(cfg.VendorDirectory, composer.InstalledJSON)))
+	} else if installed, err := composer.LoadInstalled(installedPath); err != nil {
+		problems = append(problems, err.Error())
+	} else if exists, err := helper.FileExists(lockPath); err != nil {
+		return err
+	} else if exists {
+		lock, err := composer.LoadLock(lockPath)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, installed.Diff(lock.Installed(c.installsDev()))...)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("installed packages do not match %s:\n  %s", composer.ComposerLock, strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
@@ -2,17 +2,24 @@ package runner
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/cloudfoundry/libcfbuildpack/logger"
 )
 
+// killWaitDelay bounds how long a killed command may keep its output open
+const killWaitDelay = time.Second
+
 type Runner interface {
 	Run(bin, dir string, args ...string) error
 	RunWithOutput(bin, dir string, args ...string) (string, error)
+	RunWithTimeout(timeout time.Duration, bin, dir string, args ...string) error
 }
 
 type ComposerRunner struct {
@@ -22,6 +29,46 @@ type ComposerRunner struct {
 }
 
 func (r ComposerRunner) Run(bin, dir string, args ...string) error {
+	return r.command(bin, dir, args...).Run()
+}
+
+// RunWithTimeout is like Run, but kills the command and the processes it started when it does not finish within
+// timeout
+func (r ComposerRunner) RunWithTimeout(timeout time.Duration, bin, dir string, args ...string) error {
+	cmd := r.command(bin, dir, args...)
+
+	// the command runs in its own process group, so that the processes it started are killed with it, as they would
+	// otherwise keep its output open
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return err
+		}
+
+		// processes that left the group may still hold the output open, which Wait would wait for
+		select {
+		case <-done:
+		case <-time.After(killWaitDelay):
+		}
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+func (r ComposerRunner) command(bin, dir string, args ...string) *exec.Cmd {
 	var cmd *exec.Cmd
 	if len(args) > 0 {
 		r.Logger.Debug("Running `%s %s` from directory '%s'", bin, strings.Join(args, " "), dir)
@@ -45,7 +92,7 @@ func (r ComposerRunner) Run(bin, dir string, args ...string) error {
 		cmd.Stderr = os.Stderr
 	}
 
-	return cmd.Run()
+	return cmd
 }
 
 func (r ComposerRunner) RunWithOutput(bin, dir string, args ...string) (string, error) {
@@ -76,19 +123,29 @@ func (r ComposerRunner) RunWithOutput(bin, dir string, args ...string) (string,
 
 type FakeRunner struct {
 	Arguments []string
+	Calls     [][]string
 	Cwd       string
 	Out       *bytes.Buffer
 	Err       error
 }
 
 func (f *FakeRunner) Run(bin, dir string, args ...string) error {
-	f.Arguments = append([]string{bin}, args...)
-	f.Cwd = dir
+	f.record(bin, dir, args)
 	return f.Err
 }
 
 func (f *FakeRunner) RunWithOutput(bin, dir string, args ...string) (string, error) {
+	f.record(bin, dir, args)
+	return f.Out.String(), f.Err
+}
+
+func (f *FakeRunner) RunWithTimeout(timeout time.Duration, bin, dir string, args ...string) error {
+	f.record(bin, dir, args)
+	return f.Err
+}
+
+func (f *FakeRunner) record(bin, dir string, args []string) {
 	f.Arguments = append([]string{bin}, args...)
+	f.Calls = append(f.Calls, f.Arguments)
 	f.Cwd = dir
-	return f.Out.String(), f.Err
 }
\ No newline at end of file
@@ -2,9 +2,12 @@ package runner
 
 import (
 	"bytes"
+	"fmt"
+	"syscall"
 	"github.com/cloudfoundry/libcfbuildpack/test"
 	"github.com/sclevine/spec/report"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/sclevine/spec"
@@ -50,6 +53,57 @@ func testRunner(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("Running without a timeout", func() {
+		it("should run commands in the process group of the buildpack", func() {
+			stdout := bytes.Buffer{}
+
+			runner := ComposerRunner{
+				Out:    &stdout,
+				Logger: f.Build.Logger,
+			}
+
+			Expect(runner.Run("sh", "", "-c", "cut -d ' ' -f 5 /proc/$$/stat")).To(Succeed())
+			Expect(stdout.String()).To(Equal(fmt.Sprintf("%d\n", syscall.Getpgrp())))
+		})
+	})
+
+	when("Running with a timeout", func() {
+		it("should run commands that finish in time", func() {
+			stdout := bytes.Buffer{}
+
+			runner := ComposerRunner{
+				Out:    &stdout,
+				Logger: f.Build.Logger,
+			}
+
+			Expect(runner.RunWithTimeout(time.Minute, "echo", "", "Hello")).To(Succeed())
+			Expect(stdout.String()).To(Equal("Hello\n"))
+		})
+
+		it("should kill commands that do not finish in time", func() {
+			runner := ComposerRunner{
+				Logger: f.Build.Logger,
+			}
+
+			Expect(runner.RunWithTimeout(100*time.Millisecond, "sleep", "", "10")).To(MatchError("timed out after 100ms"))
+		})
+
+		it("should kill the processes started by commands that do not finish in time", func() {
+			stdout := bytes.Buffer{}
+			stderr := bytes.Buffer{}
+
+			runner := ComposerRunner{
+				Out:    &stdout,
+				Err:    &stderr,
+				Logger: f.Build.Logger,
+			}
+
+			start := time.Now()
+			Expect(runner.RunWithTimeout(200*time.Millisecond, "sh", "", "-c", "sleep 5; true")).To(MatchError("timed out after 200ms"))
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		})
+	})
+
 	when("Running and returning output", func() {
 		it("should return stdout", func() {
 			stderr := bytes.Buffer{}